@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// --- CEF / LEEF ---
+
+// CEF のヘッダーから取り出すフィールドの名前です (ヘッダーの順)。
+var cefHeaderFields = []string{
+	"cef_version",
+	"cef_device_vendor",
+	"cef_device_product",
+	"cef_device_version",
+	"cef_signature_id",
+	"cef_name",
+	"cef_severity",
+}
+
+// LEEF のヘッダーから取り出すフィールドの名前です (ヘッダーの順)。
+var leefHeaderFields = []string{
+	"leef_version",
+	"leef_vendor",
+	"leef_product",
+	"leef_product_version",
+	"leef_event_id",
+}
+
+// leefToCEFHeader は LEEF の入力を CEF で書き出す場合に、CEF のヘッダーに使う LEEF のフィールドです。
+var leefToCEFHeader = map[string]string{
+	"cef_device_vendor":  "leef_vendor",
+	"cef_device_product": "leef_product",
+	"cef_device_version": "leef_product_version",
+	"cef_signature_id":   "leef_event_id",
+	"cef_name":           "leef_event_id",
+}
+
+// parseCEF は CEF (`CEF:0|Vendor|Product|Version|SignatureID|Name|Severity|ext`) のヘッダーと拡張を rec に設定します。
+func parseCEF(payload string, rec *inputRecord) error {
+	header, extension, err := splitCEFHeader(strings.TrimPrefix(payload, "CEF:"), len(cefHeaderFields))
+	if err != nil {
+		return fmt.Errorf("invalid CEF header: %w", err)
+	}
+	for i, name := range cefHeaderFields {
+		rec.set(name, header[i])
+	}
+	if err := parseCEFExtension(extension, rec); err != nil {
+		return fmt.Errorf("invalid CEF extension: %w", err)
+	}
+	return nil
+}
+
+// splitCEFHeader は `|` で区切られた n 個のヘッダーの値と、残りの部分を返します。
+// ヘッダーの値の `\|` と `\\` はエスケープとして扱います。
+func splitCEFHeader(s string, n int) ([]string, string, error) {
+	fields := make([]string, 0, n)
+	var current strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '|' || s[i+1] == '\\'):
+			i++
+			current.WriteByte(s[i])
+		case c == '|':
+			fields = append(fields, current.String())
+			current.Reset()
+			if len(fields) == n {
+				return fields, s[i+1:], nil
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	return nil, "", fmt.Errorf("expected %d fields separated by '|', but found %d", n, len(fields))
+}
+
+// parseCEFExtension は CEF の拡張 (`src=10.0.0.1 msg=login failed`) を rec に設定します。
+// 値には空白を含められるため、次のキーは「空白、キー、エスケープされていない =」で判断します。
+func parseCEFExtension(s string, rec *inputRecord) error {
+	type pair struct{ keyStart, eq int }
+	var pairs []pair
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] != '=' {
+			continue
+		}
+		keyStart := strings.LastIndexByte(s[:i], ' ') + 1
+		if len(pairs) > 0 && keyStart <= pairs[len(pairs)-1].eq {
+			continue // 値の中のエスケープされていない = です。
+		}
+		if keyStart == i {
+			return fmt.Errorf("missing key before '=' at column %d", i+1)
+		}
+		pairs = append(pairs, pair{keyStart, i})
+	}
+
+	if len(pairs) == 0 {
+		if strings.TrimSpace(s) != "" {
+			return fmt.Errorf("no key=value pairs in '%s'", s)
+		}
+		return nil
+	}
+	if strings.TrimSpace(s[:pairs[0].keyStart]) != "" {
+		return fmt.Errorf("unexpected text before the first key")
+	}
+	for i, p := range pairs {
+		end := len(s)
+		if i+1 < len(pairs) {
+			end = pairs[i+1].keyStart
+		}
+		rec.set(s[p.keyStart:p.eq], unescapeCEFValue(strings.TrimRight(s[p.eq+1:end], " ")))
+	}
+	return nil
+}
+
+// unescapeCEFValue は拡張の値のエスケープ (`\=`、`\\`、`\n`、`\r`) を戻します。
+func unescapeCEFValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case '=', '\\', '|':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// parseLEEF は LEEF 1.0 (`LEEF:1.0|Vendor|Product|Version|EventID|attrs`) と
+// LEEF 2.0 (`LEEF:2.0|Vendor|Product|Version|EventID|Delimiter|attrs`) のヘッダーと属性を rec に設定します。
+// 属性の区切りは LEEF 1.0 ではタブ、LEEF 2.0 ではヘッダーで指定した文字 (`^` や `x5E`) です。
+func parseLEEF(payload string, rec *inputRecord) error {
+	header, attributes, err := splitCEFHeader(strings.TrimPrefix(payload, "LEEF:"), len(leefHeaderFields))
+	if err != nil {
+		return fmt.Errorf("invalid LEEF header: %w", err)
+	}
+	for i, name := range leefHeaderFields {
+		rec.set(name, header[i])
+	}
+
+	delimiter := "\t"
+	if strings.HasPrefix(header[0], "2") {
+		spec, rest, found := strings.Cut(attributes, "|")
+		if !found {
+			return fmt.Errorf("invalid LEEF header: missing delimiter field")
+		}
+		if delimiter, err = leefDelimiter(spec); err != nil {
+			return err
+		}
+		attributes = rest
+	}
+
+	for _, attribute := range strings.Split(attributes, delimiter) {
+		if attribute == "" {
+			continue
+		}
+		key, value, found := strings.Cut(attribute, "=")
+		if !found || key == "" {
+			return fmt.Errorf("invalid LEEF attribute '%s'", attribute)
+		}
+		rec.set(key, value)
+	}
+	return nil
+}
+
+// leefDelimiter は LEEF 2.0 のヘッダーの区切り文字の指定 (`^`、`x5E`、`0x5E`) を解釈します。空の場合はタブです。
+func leefDelimiter(spec string) (string, error) {
+	if spec == "" {
+		return "\t", nil
+	}
+	if len(spec) == 1 {
+		return spec, nil
+	}
+	digits := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(spec), "0"), "x")
+	decoded, err := hex.DecodeString(digits)
+	if err != nil || len(decoded) != 1 {
+		return "", fmt.Errorf("invalid LEEF delimiter '%s'", spec)
+	}
+	return string(decoded), nil
+}
+
+// cefRecordWriter はレコードを CEF として書き出します。
+// syslog ヘッダーは入力のものをそのまま書き出し、CEF のヘッダーは cef_* (LEEF の入力では leef_*) のフィールドから作ります。
+// それ以外のフィールドは入力の順に拡張として並べ、ルックアップで追加したフィールドを末尾に加えます。
+type cefRecordWriter struct {
+	w     io.Writer
+	extra []string
+}
+
+func (c *cefRecordWriter) Write(rec *inputRecord) error {
+	var buf bytes.Buffer
+	buf.WriteString(rec.header)
+	buf.WriteString("CEF:")
+	for i, name := range cefHeaderFields {
+		value, ok := rec.fields[name]
+		if !ok {
+			value, ok = rec.fields[leefToCEFHeader[name]]
+		}
+		if i == 0 && !ok {
+			value = "0"
+		}
+		buf.WriteString(escapeCEFHeader(csvCellValue(value)))
+		buf.WriteByte('|')
+	}
+
+	first := true
+	for _, key := range orderedKeys(rec, c.extra) {
+		if slices.Contains(cefHeaderFields, key) || slices.Contains(leefHeaderFields, key) || slices.Contains(syslogHeaderFields, key) {
+			continue
+		}
+		if !first {
+			buf.WriteByte(' ')
+		}
+		first = false
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(escapeCEFValue(csvCellValue(rec.fields[key])))
+	}
+	buf.WriteByte('\n')
+	_, err := c.w.Write(buf.Bytes())
+	return err
+}
+
+func (c *cefRecordWriter) Close() error {
+	return nil
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func escapeCEFHeader(s string) string {
+	return cefHeaderEscaper.Replace(s)
+}
+
+func escapeCEFValue(s string) string {
+	return cefValueEscaper.Replace(s)
+}
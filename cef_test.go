@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCEF(t *testing.T) {
+	testCases := []struct {
+		name     string
+		payload  string
+		keys     []string
+		fields   map[string]interface{}
+		hasError bool
+	}{
+		{
+			name:    "Escapes and spaces in values",
+			payload: `CEF:0|Ven\|dor|Prod\\uct|1.0|100|Name with spaces|5|src=10.0.0.1 msg=a b\=c \\ d\nx cs1Label=Path cs1=C:\\tmp empty=`,
+			keys: []string{
+				"cef_version", "cef_device_vendor", "cef_device_product", "cef_device_version", "cef_signature_id", "cef_name", "cef_severity",
+				"src", "msg", "cs1Label", "cs1", "empty",
+			},
+			fields: map[string]interface{}{
+				"cef_version": "0", "cef_device_vendor": "Ven|dor", "cef_device_product": `Prod\uct`, "cef_device_version": "1.0",
+				"cef_signature_id": "100", "cef_name": "Name with spaces", "cef_severity": "5",
+				"src": "10.0.0.1", "msg": "a b=c \\ d\nx", "cs1Label": "Path", "cs1": `C:\tmp`, "empty": "",
+			},
+		},
+		{
+			name:    "Unescaped equals sign in a value",
+			payload: "CEF:0|V|P|1|100|N|5|request=http://x/?a=b c=d",
+			keys: []string{
+				"cef_version", "cef_device_vendor", "cef_device_product", "cef_device_version", "cef_signature_id", "cef_name", "cef_severity",
+				"request", "c",
+			},
+			fields: map[string]interface{}{
+				"cef_version": "0", "cef_device_vendor": "V", "cef_device_product": "P", "cef_device_version": "1",
+				"cef_signature_id": "100", "cef_name": "N", "cef_severity": "5",
+				"request": "http://x/?a=b", "c": "d",
+			},
+		},
+		{name: "Too few header fields", payload: "CEF:0|V|P|1|100", hasError: true},
+		{name: "Text before the first key", payload: "CEF:0|V|P|1|100|N|5|oops src=1", hasError: true},
+		{name: "No pairs", payload: "CEF:0|V|P|1|100|N|5|oops", hasError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := &inputRecord{fields: make(map[string]interface{})}
+			err := parseCEF(tc.payload, rec)
+			if tc.hasError {
+				if err == nil {
+					t.Fatalf("Expected an error, but got %v", rec.fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCEF failed: %v", err)
+			}
+			if !reflect.DeepEqual(rec.keys, tc.keys) || !reflect.DeepEqual(rec.fields, tc.fields) {
+				t.Errorf("Expected %v %v, but got %v %v", tc.keys, tc.fields, rec.keys, rec.fields)
+			}
+		})
+	}
+}
+
+func TestParseLEEF2Delimiters(t *testing.T) {
+	for _, payload := range []string{
+		"LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5",
+		"LEEF:2.0|Lancope|StealthWatch|1.0|41|x5E|src=10.0.1.8^dst=10.0.0.5",
+		"LEEF:2.0|Lancope|StealthWatch|1.0|41|0x5e|src=10.0.1.8^dst=10.0.0.5",
+	} {
+		rec := &inputRecord{fields: make(map[string]interface{})}
+		if err := parseLEEF(payload, rec); err != nil {
+			t.Fatalf("parseLEEF(%q) failed: %v", payload, err)
+		}
+		if rec.fields["src"] != "10.0.1.8" || rec.fields["dst"] != "10.0.0.5" || rec.fields["leef_event_id"] != "41" {
+			t.Errorf("Unexpected fields for %q: %v", payload, rec.fields)
+		}
+	}
+	rec := &inputRecord{fields: make(map[string]interface{})}
+	if err := parseLEEF("LEEF:2.0|V|P|1|41|xZZ|a=b", rec); err == nil {
+		t.Error("Expected an error for an invalid delimiter")
+	}
+}
+
+func TestCEFRoundTrip(t *testing.T) {
+	line := `<134>Feb 14 19:04:54 fw01 CEF:0|Ven\|dor|FW|1.0|100|Login failed|3|suser=bob msg=a b\=c \\ d\nx src=10.0.0.1`
+	rec, err := parseSyslogLine(line)
+	if err != nil {
+		t.Fatalf("parseSyslogLine failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := (&cefRecordWriter{w: &out}).Write(rec); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if out.String() != line+"\n" {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", line, out.String())
+	}
+}
+
+func TestProcessInputSyslogToCEF(t *testing.T) {
+	input := "<134>Feb 14 19:04:54 fw01 CEF:0|Vendor|FW|1.0|100|Login|3|suser=alice src=10.0.0.1\n" +
+		"LEEF:1.0|Vendor|EDR|2.0|proc|suser=bob\tsev=2\n" +
+		`{"suser": "nobody"}` + "\n"
+	processor := newTestProcessor(t, "suser as name OUTPUT dept as suser_dept, title")
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader(input), "-", &out, ioFormats{input: "syslog", output: "cef"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	// The OUTPUT fields are added as extensions in OUTPUT order, LEEF headers fill the CEF header,
+	// and the JSON line, which is not a syslog message, is skipped.
+	expected := `<134>Feb 14 19:04:54 fw01 CEF:0|Vendor|FW|1.0|100|Login|3|suser=alice src=10.0.0.1 suser_dept=Sales, EMEA title=Manager` + "\n" +
+		`CEF:0|Vendor|EDR|2.0|proc|proc||suser=bob sev=2 suser_dept=Engineering title=` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
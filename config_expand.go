@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// --- 設定ファイルの環境変数展開と include ---
+
+// configIncludeKey は、他の設定ファイルを取り込むためのキーです。
+const configIncludeKey = "include"
+
+// loadConfigDocument は設定ファイルを読み込み、環境変数の展開と include の取り込みを行った汎用的な値を返します。
+// visiting は include の循環を検出するために、読み込み中のファイルを保持します。
+func loadConfigDocument(path string, visiting map[string]bool) (map[string]interface{}, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+	doc, err := parseConfigDocument(file, configFormatFromPath(path))
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := expandConfigValue(doc, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	doc = expanded.(map[string]interface{})
+
+	includes, err := configIncludes(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	delete(doc, configIncludeKey)
+	if len(includes) == 0 {
+		return doc, nil
+	}
+
+	if visiting == nil {
+		visiting = make(map[string]bool)
+	}
+	visiting[path] = true
+	defer delete(visiting, path)
+
+	// 取り込んだ設定を先に重ね、このファイル自身の設定で上書きします。
+	merged := map[string]interface{}{}
+	for _, include := range includes {
+		includePath := resolveDataSourcePath(path, include)
+		if visiting[includePath] {
+			return nil, fmt.Errorf("%s: circular include of %s", path, includePath)
+		}
+		included, err := loadConfigDocument(includePath, visiting)
+		if err != nil {
+			return nil, fmt.Errorf("could not include %s: %w", include, err)
+		}
+		merged = mergeConfigDocuments(merged, included)
+	}
+	return mergeConfigDocuments(merged, doc), nil
+}
+
+// configFiles は設定ファイルと、include で取り込まれるすべてのファイルのパスを返します。
+// 読み込めないファイルはそれ以上たどりません。
+func configFiles(path string) []string {
+	files := []string{path}
+	seen := map[string]bool{path: true}
+	for i := 0; i < len(files); i++ {
+		data, err := os.ReadFile(files[i])
+		if err != nil {
+			continue
+		}
+		doc, err := parseConfigDocument(data, configFormatFromPath(files[i]))
+		if err != nil {
+			continue
+		}
+		includes, _ := configIncludes(doc)
+		for _, include := range includes {
+			expanded, err := expandEnvReferences(include)
+			if err != nil {
+				continue
+			}
+			includePath := resolveDataSourcePath(files[i], expanded)
+			if !seen[includePath] {
+				seen[includePath] = true
+				files = append(files, includePath)
+			}
+		}
+	}
+	return files
+}
+
+// configIncludes は include の値 (文字列または文字列の配列) を取り出します。
+func configIncludes(doc map[string]interface{}) ([]string, error) {
+	switch v := doc[configIncludeKey].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		includes := make([]string, 0, len(v))
+		for _, elem := range v {
+			s, ok := elem.(string)
+			if !ok {
+				return nil, fmt.Errorf("'%s' must be a string or a list of strings", configIncludeKey)
+			}
+			includes = append(includes, s)
+		}
+		return includes, nil
+	default:
+		return nil, fmt.Errorf("'%s' must be a string or a list of strings", configIncludeKey)
+	}
+}
+
+// mergeConfigDocuments は override を base に重ねます。
+// オブジェクトはキーごとに再帰的に統合し、配列は override の要素を先にして連結します。
+// 配列を連結するため、同じ input_field と lookup_field の matcher は override のものが先に見つかります。
+func mergeConfigDocuments(base, override map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		result[key] = value
+	}
+	for key, value := range override {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if b, ok := result[key].(map[string]interface{}); ok {
+				result[key] = mergeConfigDocuments(b, v)
+				continue
+			}
+		case []interface{}:
+			if b, ok := result[key].([]interface{}); ok {
+				result[key] = append(append([]interface{}{}, v...), b...)
+				continue
+			}
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// expandConfigValue は値に含まれるすべての文字列の ${VAR} / ${VAR:-default} を展開します。
+// location はエラーメッセージに含める設定項目の位置です (例: "matchers[0].input_field")。
+func expandConfigValue(value interface{}, location string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		expanded, err := expandEnvReferences(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", location, err)
+		}
+		return expanded, nil
+	case map[string]interface{}:
+		// エラーメッセージが毎回同じになるよう、キーの順に処理します。
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := key
+			if location != "" {
+				child = location + "." + key
+			}
+			expanded, err := expandConfigValue(v[key], child)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+		return v, nil
+	case []interface{}:
+		for i, elem := range v {
+			expanded, err := expandConfigValue(elem, fmt.Sprintf("%s[%d]", location, i))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// expandEnvReferences は ${VAR} と ${VAR:-default} を環境変数で展開します。
+// ${VAR:-default} は変数が未設定または空の場合に default を使用します。
+// default のない参照で変数が未設定の場合はエラーを返します。
+// "$${" は展開されず、"${" という文字列になります。それ以外の "$" はそのまま残ります。
+func expandEnvReferences(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "$${") {
+			b.WriteString("${")
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s)
+		}
+		ref := s[i+2 : i+end]
+		name, def, hasDefault := strings.Cut(ref, ":-")
+		if !isEnvVarName(name) {
+			return "", fmt.Errorf("invalid variable reference '${%s}'", ref)
+		}
+		value, ok := os.LookupEnv(name)
+		switch {
+		case hasDefault && value == "":
+			value = def
+		case !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		b.WriteString(value)
+		i += end + 1
+	}
+	return b.String(), nil
+}
+
+// isEnvVarName は環境変数名として有効か ([A-Za-z_][A-Za-z0-9_]*) を判定します。
+func isEnvVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnvReferences(t *testing.T) {
+	t.Setenv("LOOKUP_TEST_DIR", "/srv/tables")
+	t.Setenv("LOOKUP_TEST_EMPTY", "")
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "${LOOKUP_TEST_DIR}/users.csv", expected: "/srv/tables/users.csv"},
+		{input: "${LOOKUP_TEST_UNSET:-./users.csv}", expected: "./users.csv"},
+		{input: "${LOOKUP_TEST_EMPTY:-fallback}", expected: "fallback"},
+		{input: "${LOOKUP_TEST_EMPTY}", expected: ""},
+		{input: "${LOOKUP_TEST_UNSET:-}", expected: ""},
+		{input: "^user-[0-9]+$", expected: "^user-[0-9]+$"},
+		{input: "$${LOOKUP_TEST_DIR}", expected: "${LOOKUP_TEST_DIR}"},
+	}
+	for _, tc := range testCases {
+		got, err := expandEnvReferences(tc.input)
+		if err != nil {
+			t.Errorf("expandEnvReferences(%q) failed: %v", tc.input, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("expandEnvReferences(%q): expected %q, but got %q", tc.input, tc.expected, got)
+		}
+	}
+
+	for _, input := range []string{"${LOOKUP_TEST_UNSET}", "${unterminated", "${1BAD}"} {
+		if _, err := expandEnvReferences(input); err == nil {
+			t.Errorf("expandEnvReferences(%q): expected an error, but got nil", input)
+		}
+	}
+}
+
+func TestLoadConfigExpandsEnv(t *testing.T) {
+	t.Setenv("LOOKUP_TEST_TOKEN", "secret")
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `data_source: ${LOOKUP_TEST_DATA:-./users.csv}
+type: http
+http:
+  url: https://cmdb.example/{value}
+  headers:
+    Authorization: Bearer ${LOOKUP_TEST_TOKEN}
+matchers:
+  - input_field: user
+    lookup_field: username
+`
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if config.DataSource != "./users.csv" {
+		t.Errorf("Expected data_source './users.csv', but got %q", config.DataSource)
+	}
+	if got := config.HTTP.Headers["Authorization"]; got != "Bearer secret" {
+		t.Errorf("Expected expanded header, but got %q", got)
+	}
+
+	missing := strings.Replace(content, "${LOOKUP_TEST_TOKEN}", "${LOOKUP_TEST_UNSET_TOKEN}", 1)
+	if err := os.WriteFile(configPath, []byte(missing), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	_, err = loadConfig(configPath)
+	if err == nil {
+		t.Fatal("Expected an error for an unset environment variable, but got nil")
+	}
+	for _, want := range []string{"http.headers.Authorization", "LOOKUP_TEST_UNSET_TOKEN"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %q, but got: %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	write("common.toml", `
+[[matchers]]
+input_field = "user"
+lookup_field = "username"
+
+[[matchers]]
+input_field = "ip"
+lookup_field = "ip_range"
+method = "cidr"
+`)
+	configPath := write("team.json", `{
+  "include": "common.toml",
+  "data_source": "./users.csv",
+  "matchers": [
+    {"input_field": "user", "lookup_field": "username", "case_sensitive": true}
+  ]
+}`)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	// The including file's own matchers come first, so they take precedence.
+	expected := []Matcher{
+		{InputField: "user", LookupField: "username", Method: "exact", CaseSensitive: true},
+		{InputField: "user", LookupField: "username", Method: "exact"},
+		{InputField: "ip", LookupField: "ip_range", Method: "cidr"},
+	}
+	if !reflect.DeepEqual(config.Matchers, expected) {
+		t.Errorf("Expected matchers %+v, but got %+v", expected, config.Matchers)
+	}
+	if config.DataSource != "./users.csv" {
+		t.Errorf("Expected data_source './users.csv', but got %q", config.DataSource)
+	}
+
+	files := configFiles(configPath)
+	if want := []string{configPath, filepath.Join(dir, "common.toml")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Expected config files %v, but got %v", want, files)
+	}
+
+	write("a.json", `{"include": ["b.json"]}`)
+	loop := write("b.json", `{"include": ["a.json"]}`)
+	if _, err := loadConfig(loop); err == nil || !strings.Contains(err.Error(), "circular include") {
+		t.Errorf("Expected a circular include error, but got %v", err)
+	}
+}
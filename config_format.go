@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// --- 設定ファイルの形式 (JSON / YAML / TOML) ---
+
+// configFormats は対応する設定ファイルの形式です。
+var configFormats = []string{"json", "yaml", "toml"}
+
+// configFormatFromPath は拡張子から設定ファイルの形式を判定します。
+// .yaml / .yml は YAML、.toml は TOML、それ以外は JSON として扱います。
+func configFormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// parseConfigDocument は設定ファイルの内容を、形式に依存しない汎用的な値に変換します。
+// 構造体への変換は JSON のタグに統一するため、どの形式も一度この値を経由します。
+func parseConfigDocument(data []byte, format string) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("could not parse config JSON: %w", err)
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("could not parse config YAML: %w", err)
+		}
+	case "toml":
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("could not parse config TOML: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format '%s'", format)
+	}
+	if doc == nil {
+		return map[string]interface{}{}, nil
+	}
+	normalized, err := normalizeConfigValue(doc)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config %s: %w", strings.ToUpper(format), err)
+	}
+	return normalized.(map[string]interface{}), nil
+}
+
+// normalizeConfigValue は YAML / TOML のデコード結果を JSON と同じ型 (map[string]interface{} と []interface{}) に揃えます。
+// キーが文字列でないマップは JSON に変換できないためエラーにします。
+func normalizeConfigValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			normalized, err := normalizeConfigValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = normalized
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			s, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("mapping key %v is not a string", key)
+			}
+			normalized, err := normalizeConfigValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			result[s] = normalized
+		}
+		return result, nil
+	case []map[string]interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			normalized, err := normalizeConfigValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = normalized
+		}
+		return result, nil
+	case []interface{}:
+		for i, elem := range v {
+			normalized, err := normalizeConfigValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = normalized
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// decodeConfigDocument は汎用的な値を Config に変換します。
+func decodeConfigDocument(doc map[string]interface{}) (*Config, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode config: %w", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("could not decode config: %w", err)
+	}
+	return &config, nil
+}
+
+// encodeConfig は Config を指定した形式で出力します。
+// フィールド名は JSON のタグと同じものを使用します。
+// matcherComments は各 matcher の前に付けるコメントです。コメントを書けない JSON では無視します。
+func encodeConfig(config *Config, format string, matcherComments []string) ([]byte, error) {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "json":
+		return data, nil
+	case "yaml":
+		// YAML は JSON の上位互換のため、フィールドの順序を保ったままノードとして読み込めます。
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		clearYAMLStyle(&node)
+		if matchers := yamlMappingValue(node.Content[0], "matchers"); matchers != nil {
+			for i, item := range matchers.Content {
+				if i < len(matcherComments) {
+					item.HeadComment = commentLines(matcherComments[i])
+				}
+			}
+		}
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&node); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(buf.Bytes(), "\n"), nil
+	case "toml":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var doc map[string]interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		encoder := toml.NewEncoder(&buf)
+		encoder.Indent = ""
+		if err := encoder.Encode(tomlValue(doc)); err != nil {
+			return nil, err
+		}
+		return insertTOMLMatcherComments(bytes.TrimRight(buf.Bytes(), "\n"), matcherComments), nil
+	default:
+		return nil, fmt.Errorf("unsupported config format '%s'", format)
+	}
+}
+
+// clearYAMLStyle は JSON 由来のフロースタイルや引用符を取り除き、通常のブロックスタイルにします。
+func clearYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearYAMLStyle(child)
+	}
+}
+
+// tomlValue は json.Number を TOML の整数または浮動小数点数に変換します。
+func tomlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = tomlValue(elem)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = tomlValue(elem)
+		}
+		return v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
+
+// yamlMappingValue はマッピングノードから key の値のノードを返します。
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// commentLines は複数行のテキストを "# " で始まるコメント行にします。
+func commentLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = "# " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// insertTOMLMatcherComments は TOML の各 [[matchers]] の前にコメントを挿入します。
+// TOML のエンコーダーはコメントを出力できないため、出力後の行に追加します。
+func insertTOMLMatcherComments(data []byte, matcherComments []string) []byte {
+	if len(matcherComments) == 0 {
+		return data
+	}
+	var out bytes.Buffer
+	index := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "[[matchers]]" && index < len(matcherComments) {
+			out.WriteString(commentLines(matcherComments[index]) + "\n")
+			index++
+		}
+		out.WriteString(line + "\n")
+	}
+	return bytes.TrimRight(out.Bytes(), "\n")
+}
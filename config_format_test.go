@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigFormatFromPath(t *testing.T) {
+	testCases := map[string]string{
+		"config.json": "json",
+		"config.yaml": "yaml",
+		"config.YML":  "yaml",
+		"config.toml": "toml",
+		"config":      "json",
+	}
+	for path, expected := range testCases {
+		if got := configFormatFromPath(path); got != expected {
+			t.Errorf("configFormatFromPath(%q): expected %q, but got %q", path, expected, got)
+		}
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	expected := &Config{
+		DataSource: "./users.csv",
+		HTTP:       &HTTPSourceConfig{URL: "https://cmdb/api/{value}", Retries: 2},
+		Matchers: []Matcher{
+			{InputField: "user", LookupField: "username", Method: "exact"},
+			{InputField: "ip", LookupField: "ip_range", Method: "cidr", CaseSensitive: true},
+		},
+	}
+
+	testCases := map[string]string{
+		"config.yaml": `# Shared user lookup
+data_source: ./users.csv
+http:
+  url: "https://cmdb/api/{value}"
+  retries: 2
+matchers:
+  - input_field: user      # method defaults to exact
+    lookup_field: username
+  - input_field: ip
+    lookup_field: ip_range
+    method: cidr
+    case_sensitive: true
+`,
+		"config.toml": `# Shared user lookup
+data_source = "./users.csv"
+
+[http]
+url = "https://cmdb/api/{value}"
+retries = 2
+
+[[matchers]]
+input_field = "user" # method defaults to exact
+lookup_field = "username"
+
+[[matchers]]
+input_field = "ip"
+lookup_field = "ip_range"
+method = "cidr"
+case_sensitive = true
+`,
+	}
+
+	for name, content := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			config, err := loadConfig(path)
+			if err != nil {
+				t.Fatalf("loadConfig failed: %v", err)
+			}
+			if !reflect.DeepEqual(config, expected) {
+				t.Errorf("Expected %+v, but got %+v", expected, config)
+			}
+		})
+	}
+}
+
+func TestEncodeConfigRoundTrip(t *testing.T) {
+	config := &Config{
+		DataSource: "./users.csv",
+		Matchers: []Matcher{
+			// Values that YAML would otherwise read as other types must stay strings.
+			{InputField: "true", LookupField: "123", Method: "exact"},
+			{InputField: "ip", LookupField: "ip_range", Method: "cidr", CaseSensitive: true},
+		},
+	}
+	for _, format := range configFormats {
+		t.Run(format, func(t *testing.T) {
+			data, err := encodeConfig(config, format, nil)
+			if err != nil {
+				t.Fatalf("encodeConfig failed: %v", err)
+			}
+			path := filepath.Join(t.TempDir(), "config."+format)
+			if err := os.WriteFile(path, data, 0600); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			loaded, err := loadConfig(path)
+			if err != nil {
+				t.Fatalf("loadConfig failed: %v\n%s", err, data)
+			}
+			if !reflect.DeepEqual(loaded, config) {
+				t.Errorf("Expected %+v, but got %+v\n%s", config, loaded, data)
+			}
+		})
+	}
+}
+
+func TestLoadConfigInvalidYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("matchers: [unclosed\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := loadConfig(path); err == nil {
+		t.Error("Expected an error for invalid YAML, but got nil")
+	}
+}
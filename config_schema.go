@@ -0,0 +1,278 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- 設定ファイルの JSON Schema ---
+
+// configSchemaJSON は公開している設定ファイルの JSON Schema です (schema/config.schema.json)。
+//
+//go:embed schema/config.schema.json
+var configSchemaJSON []byte
+
+// jsonSchema は、設定ファイルの検証に必要な JSON Schema のキーワードのみを扱います。
+// 対応するキーワード: type, properties, additionalProperties, required, enum, items, minimum, pattern
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Required             []string               `json:"required"`
+	Enum                 []interface{}          `json:"enum"`
+	Items                *jsonSchema            `json:"items"`
+	Minimum              *float64               `json:"minimum"`
+	Pattern              string                 `json:"pattern"`
+
+	reject  bool // false スキーマ: どの値も受け付けない
+	pattern *regexp.Regexp
+}
+
+// schemaTypes は文字列または文字列の配列で指定される type キーワードです。
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*t = multiple
+	return nil
+}
+
+// UnmarshalJSON は真偽値のスキーマ (true はすべてを許可、false はすべてを拒否) にも対応します。
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*s = jsonSchema{reject: !b}
+		return nil
+	}
+	type plain jsonSchema
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*s = jsonSchema(p)
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	return nil
+}
+
+// loadConfigSchema は埋め込まれた設定ファイルのスキーマを読み込みます。
+func loadConfigSchema() (*jsonSchema, error) {
+	var schema jsonSchema
+	if err := json.Unmarshal(configSchemaJSON, &schema); err != nil {
+		return nil, fmt.Errorf("could not parse config schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// schemaViolation はスキーマに違反した箇所です。
+// Path は "matchers[0].method" のような設定項目の位置です。
+type schemaViolation struct {
+	Path    string
+	Message string
+}
+
+// validate は値をスキーマで検証し、すべての違反を返します。
+func (s *jsonSchema) validate(value interface{}, path string) []schemaViolation {
+	if s.reject {
+		return []schemaViolation{{Path: path, Message: "is not allowed"}}
+	}
+	var violations []schemaViolation
+	add := func(format string, args ...interface{}) {
+		violations = append(violations, schemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	actual := schemaTypeOf(value)
+	if len(s.Type) > 0 && !s.allowsType(actual) {
+		add("expected %s, got %s", strings.Join(s.Type, " or "), actual)
+		return violations
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names := make([]string, len(s.Enum))
+			for i, allowed := range s.Enum {
+				names[i] = fmt.Sprint(allowed)
+			}
+			add("%q is not one of %s", fmt.Sprint(value), strings.Join(names, ", "))
+		}
+	}
+	if s.pattern != nil {
+		if str, ok := value.(string); ok && !s.pattern.MatchString(str) {
+			add("%q does not match the pattern %s", str, s.Pattern)
+		}
+	}
+	if s.Minimum != nil {
+		if n, ok := schemaNumber(value); ok && n < *s.Minimum {
+			add("must be greater than or equal to %v", *s.Minimum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				add("missing required field %q", name)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := joinConfigPath(path, key)
+			if prop, ok := s.Properties[key]; ok {
+				violations = append(violations, prop.validate(v[key], child)...)
+				continue
+			}
+			if s.AdditionalProperties == nil {
+				continue
+			}
+			if s.AdditionalProperties.reject {
+				message := fmt.Sprintf("unknown field %q", key)
+				if suggestion := closestName(key, s.Properties); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				violations = append(violations, schemaViolation{Path: child, Message: message})
+				continue
+			}
+			violations = append(violations, s.AdditionalProperties.validate(v[key], child)...)
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, elem := range v {
+				violations = append(violations, s.Items.validate(elem, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return violations
+}
+
+func (s *jsonSchema) allowsType(actual string) bool {
+	for _, t := range s.Type {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaTypeOf は JSON / YAML / TOML のデコード結果の JSON Schema 上の型名を返します。
+func schemaTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "integer"
+	case float32, float64:
+		if f, _ := schemaNumber(v); f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case time.Time:
+		return "datetime"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// schemaNumber は数値型の値を float64 に変換します。
+func schemaNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// joinConfigPath は設定項目の位置にキーを追加します。
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// closestName は name に最も近い (編集距離2以内の) プロパティ名を返します。
+func closestName(name string, properties map[string]*jsonSchema) string {
+	best, bestDistance := "", 3
+	for candidate := range properties {
+		d := editDistance(name, candidate)
+		if d < bestDistance || (d == bestDistance && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance は2つの文字列のレーベンシュタイン距離を返します。
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// --- マッチング判定の説明 (--explain) ---
+
+// explainFieldName は --explain=field でレコードに追加するフィールド名です。
+const explainFieldName = "_lookup_debug"
+
+// 説明の result の値です。
+const (
+	explainMatched = "matched"
+	explainNoMatch = "no_match"
+	explainSkipped = "skipped" // 入力フィールドがない、または文字列ではない
+	explainError   = "error"
+)
+
+// lookupExplanation は1件のルックアップでどのように一致を判定したかを表します。
+type lookupExplanation struct {
+	InputField      string      `json:"input_field"`
+	InputValue      interface{} `json:"input_value,omitempty"`
+	NormalizedValue string      `json:"normalized_value,omitempty"`
+	Source          string      `json:"source,omitempty"` // "table", "snapshot", "kv", "mmdb", "http", "dns"
+	LookupField     string      `json:"lookup_field,omitempty"`
+	Method          string      `json:"method,omitempty"`
+	CaseSensitive   *bool       `json:"case_sensitive,omitempty"`
+	Index           string      `json:"index,omitempty"` // 行を走査せずに索引を引いた場合の索引の種類
+	RowsConsidered  int         `json:"rows_considered,omitempty"`
+	MatchedRow      int         `json:"matched_row,omitempty"`   // データソースの何行目のデータか (1始まり)
+	MatchedValue    string      `json:"matched_value,omitempty"` // 一致した行の lookup_field の値 (パターン)
+	Result          string      `json:"result"`
+	Reason          string      `json:"reason,omitempty"`
+}
+
+// explainer は判定の過程を説明できる Lookuper が実装します。
+// 戻り値の行は Lookup と同じです。
+type explainer interface {
+	Explain(value string) (map[string]string, *lookupExplanation, error)
+}
+
+// explainLookup は lookuper が explainer であれば判定の説明とともに、そうでなければ結果のみから説明を作ります。
+func explainLookup(lookuper Lookuper, value string) (map[string]string, *lookupExplanation, error) {
+	if e, ok := lookuper.(explainer); ok {
+		return e.Explain(value)
+	}
+	row, err := lookuper.Lookup(value)
+	ex := &lookupExplanation{NormalizedValue: value}
+	ex.finish(row != nil, "")
+	return row, ex, err
+}
+
+// withMatcher は matcher の設定を説明に記録します。
+func (ex *lookupExplanation) withMatcher(matcher *Matcher) *lookupExplanation {
+	ex.LookupField = matcher.LookupField
+	ex.Method = matcher.Method
+	ex.CaseSensitive = &matcher.CaseSensitive
+	return ex
+}
+
+// finish は結果を記録します。一致しなかった場合の理由は reason、空であれば既定の文言です。
+func (ex *lookupExplanation) finish(matched bool, reason string) {
+	if matched {
+		ex.Result = explainMatched
+		return
+	}
+	ex.Result = explainNoMatch
+	if reason == "" {
+		reason = "no match"
+	}
+	ex.Reason = reason
+}
+
+// noMatchReason はテーブルを走査して一致しなかった理由を組み立てます。
+func noMatchReason(considered, missing, invalid int, lookupField string) string {
+	if considered == 0 {
+		return "data source has no rows"
+	}
+	reason := fmt.Sprintf("none of %d rows matched", considered)
+	var notes []string
+	if missing > 0 {
+		notes = append(notes, fmt.Sprintf("%d without '%s'", missing, lookupField))
+	}
+	if invalid > 0 {
+		notes = append(notes, fmt.Sprintf("%d with invalid patterns", invalid))
+	}
+	if len(notes) > 0 {
+		reason += " (" + strings.Join(notes, ", ") + ")"
+	}
+	return reason
+}
+
+// writeExplanation は説明を1行のJSONとして出力します。
+func writeExplanation(w io.Writer, ex *lookupExplanation) error {
+	line, err := json.Marshal(ex)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(line))
+	return err
+}
+
+// jsonTypeName は入力フィールドの値のJSON上の型名を返します。
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
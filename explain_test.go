@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTableLookuperExplain(t *testing.T) {
+	data := LookupData{
+		{"name": "alpha", "network": "10.1.0.0/16", "pattern": "web-*"},
+		{"name": "beta", "network": "not-a-cidr", "pattern": "[invalid"},
+		{"network": "10.0.0.0/8", "pattern": "*"},
+	}
+	testCases := []struct {
+		name     string
+		matcher  Matcher
+		value    string
+		expected lookupExplanation
+	}{
+		{
+			name:    "Exact match",
+			matcher: Matcher{LookupField: "name", Method: "exact"},
+			value:   "BETA",
+			expected: lookupExplanation{
+				NormalizedValue: "beta", RowsConsidered: 2, MatchedRow: 2, MatchedValue: "beta", Result: explainMatched,
+			},
+		},
+		{
+			name:    "No match with missing fields",
+			matcher: Matcher{LookupField: "name", Method: "exact", CaseSensitive: true},
+			value:   "BETA",
+			expected: lookupExplanation{
+				NormalizedValue: "BETA", RowsConsidered: 3, Result: explainNoMatch,
+				Reason: "none of 3 rows matched (1 without 'name')",
+			},
+		},
+		{
+			name:    "Invalid patterns are skipped",
+			matcher: Matcher{LookupField: "pattern", Method: "wildcard"},
+			value:   "mail-01",
+			expected: lookupExplanation{
+				NormalizedValue: "mail-01", RowsConsidered: 3, MatchedRow: 3, MatchedValue: "*", Result: explainMatched,
+			},
+		},
+		{
+			name:    "CIDR with invalid rows",
+			matcher: Matcher{LookupField: "network", Method: "cidr"},
+			value:   "192.168.0.1",
+			expected: lookupExplanation{
+				NormalizedValue: "192.168.0.1", RowsConsidered: 3, Result: explainNoMatch,
+				Reason: "none of 3 rows matched (1 with invalid patterns)",
+			},
+		},
+		{
+			name:    "CIDR with a non-IP value",
+			matcher: Matcher{LookupField: "network", Method: "cidr"},
+			value:   "web-01",
+			expected: lookupExplanation{
+				NormalizedValue: "web-01", Result: explainNoMatch, Reason: "input value is not an IP address",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lookuper := &tableLookuper{data: data, matcher: &tc.matcher}
+			row, ex, err := lookuper.Explain(tc.value)
+			if err != nil {
+				t.Fatalf("Explain failed: %v", err)
+			}
+			if expectedRow := findMatch(tc.value, data, &tc.matcher); !reflect.DeepEqual(row, expectedRow) {
+				t.Errorf("Expected row %v, but got %v", expectedRow, row)
+			}
+			expected := tc.expected
+			expected.Source = "table"
+			expected.withMatcher(&tc.matcher)
+			if !reflect.DeepEqual(*ex, expected) {
+				t.Errorf("Expected %+v, but got %+v", expected, *ex)
+			}
+		})
+	}
+}
+
+func TestSnapshotExplainMatchesTable(t *testing.T) {
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "table.csv")
+	if err := os.WriteFile(sourcePath, []byte(snapshotTestCSV), 0600); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+	matchers := []Matcher{
+		{LookupField: "name", Method: "exact"},
+		{LookupField: "network", Method: "cidr"},
+		{LookupField: "pattern", Method: "wildcard"},
+	}
+	snapshotPath := filepath.Join(dir, "table.snap")
+	if err := buildSnapshot(sourcePath, matchers, snapshotPath); err != nil {
+		t.Fatalf("buildSnapshot failed: %v", err)
+	}
+	data, err := loadLookupData(sourcePath)
+	if err != nil {
+		t.Fatalf("loadLookupData failed: %v", err)
+	}
+
+	for i := range matchers {
+		matcher := &matchers[i]
+		lookuper, err := loadSnapshotLookuper(snapshotPath, sourcePath, matcher)
+		if err != nil {
+			t.Fatalf("loadSnapshotLookuper failed: %v", err)
+		}
+		table := &tableLookuper{data: data, matcher: matcher}
+		for _, value := range []string{"ALPHA", "delta", "unknown", "10.1.2.3", "2001:db8::1", "not-an-ip", "web-01"} {
+			_, want, _ := table.Explain(value)
+			_, got, err := lookuper.Explain(value)
+			if err != nil {
+				t.Fatalf("Explain(%q) failed: %v", value, err)
+			}
+			if got.Result != want.Result || got.MatchedRow != want.MatchedRow || got.MatchedValue != want.MatchedValue {
+				t.Errorf("Explain(%q) with %+v: expected %s row %d (%q), but got %s row %d (%q)",
+					value, matcher, want.Result, want.MatchedRow, want.MatchedValue, got.Result, got.MatchedRow, got.MatchedValue)
+			}
+		}
+		lookuper.Close()
+	}
+}
+
+func TestProcessObjectExplain(t *testing.T) {
+	matcher := &Matcher{InputField: "user", LookupField: "name", Method: "exact"}
+	lookuper := &tableLookuper{data: LookupData{{"name": "alice", "dept": "Sales"}}, matcher: matcher}
+	mapping := &Mapping{InputField: "user", LookupField: "name", OutputMap: map[string]string{"dept": "department"}}
+
+	t.Run("field", func(t *testing.T) {
+		processor := &recordProcessor{mapping: mapping, lookuper: lookuper, explain: "field"}
+		testCases := []struct {
+			record map[string]interface{}
+			result string
+			reason string
+		}{
+			{record: map[string]interface{}{"user": "Alice"}, result: explainMatched},
+			{record: map[string]interface{}{"user": "bob"}, result: explainNoMatch, reason: "none of 1 rows matched"},
+			{record: map[string]interface{}{"other": "alice"}, result: explainSkipped, reason: "input field 'user' not found in record"},
+			{record: map[string]interface{}{"user": 42.0}, result: explainSkipped, reason: "input field 'user' is not a string (got number)"},
+		}
+		for _, tc := range testCases {
+			out, _, _ := processor.processObject(tc.record)
+			ex, ok := out[explainFieldName].(*lookupExplanation)
+			if !ok {
+				t.Fatalf("Expected %s field in %v", explainFieldName, out)
+			}
+			if ex.InputField != "user" || ex.Result != tc.result || ex.Reason != tc.reason {
+				t.Errorf("For %v: expected (%s, %q), but got %+v", tc.record, tc.result, tc.reason, ex)
+			}
+		}
+	})
+
+	t.Run("stderr", func(t *testing.T) {
+		var buf bytes.Buffer
+		processor := &recordProcessor{mapping: mapping, lookuper: lookuper, explain: "stderr", explainOutput: &buf}
+		out, _, _ := processor.processObject(map[string]interface{}{"user": "alice"})
+		if _, ok := out[explainFieldName]; ok {
+			t.Errorf("Expected no %s field in stderr mode, but got %v", explainFieldName, out)
+		}
+		if out["department"] != "Sales" {
+			t.Errorf("Expected the record to be enriched, but got %v", out)
+		}
+		expected := `{"input_field":"user","input_value":"alice","normalized_value":"alice","source":"table","lookup_field":"name","method":"exact","case_sensitive":false,"rows_considered":1,"matched_row":1,"matched_value":"alice","result":"matched"}` + "\n"
+		if buf.String() != expected {
+			t.Errorf("Expected explanation:\n%s\nbut got:\n%s", expected, buf.String())
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// --- 出力のバッファリング (--flush) ---
+
+// flushModes は --flush で指定できる書き出しの方針です。
+var flushModes = []string{"every-record", "interval", "size"}
+
+// flushPolicy は出力をバッファリングし、いつ書き出すかの方針です。
+// 方針に従って作った出力を保持し、シグナルを受け取ったときにまとめて書き出せるようにします。
+type flushPolicy struct {
+	mode     string        // "every-record"、"interval"、"size" のいずれか
+	interval time.Duration // "interval" で書き出す間隔
+	size     int           // バッファがこのバイト数に達したら書き出す
+
+	mu      sync.Mutex
+	outputs map[*bufferedOutput]struct{}
+}
+
+// bufferedOutput はレコード単位でバッファリングする出力です。
+// 書き出すのは processInput から recordDone で通知された、完結したレコードまでに限るため、
+// どの方針でも、書き出しの途中で読み手に途中までのレコードが見えることはありません。
+type bufferedOutput struct {
+	policy *flushPolicy
+	dst    io.Writer
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	complete int   // buf のうち、完結したレコードのバイト数
+	err      error // バックグラウンドでの書き出しのエラー
+	done     chan struct{}
+}
+
+// wrap は w を方針に従ってバッファリングする出力を作ります。使い終わったら Close で残りを書き出します。
+func (p *flushPolicy) wrap(w io.Writer) *bufferedOutput {
+	b := &bufferedOutput{policy: p, dst: w, done: make(chan struct{})}
+	p.mu.Lock()
+	if p.outputs == nil {
+		p.outputs = make(map[*bufferedOutput]struct{})
+	}
+	p.outputs[b] = struct{}{}
+	p.mu.Unlock()
+	if p.mode == "interval" {
+		go b.flushEvery(p.interval)
+	}
+	return b
+}
+
+// flushAll はすべての出力の完結したレコードを書き出します。
+func (p *flushPolicy) flushAll() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for b := range p.outputs {
+		b.mu.Lock()
+		if err := b.flush(); err != nil {
+			errs = append(errs, err)
+		}
+		b.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+func (b *bufferedOutput) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.buf.Write(p)
+}
+
+// recordDone はここまでに書き込まれたバイト列を完結したレコードとし、方針に応じて書き出します。
+// "interval" でも、バッファが size に達した場合は書き出します。
+func (b *bufferedOutput) recordDone() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.complete = b.buf.Len()
+	if b.policy.mode == "every-record" || b.complete >= b.policy.size {
+		return b.flush()
+	}
+	return nil
+}
+
+// flush は完結したレコードを書き出します。呼び出し側が mu を保持している必要があります。
+func (b *bufferedOutput) flush() error {
+	if b.complete == 0 || b.err != nil {
+		return b.err
+	}
+	_, err := b.dst.Write(b.buf.Next(b.complete))
+	b.complete = 0
+	if err != nil {
+		b.err = err
+	}
+	return err
+}
+
+func (b *bufferedOutput) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+		b.mu.Lock()
+		b.flush()
+		b.mu.Unlock()
+	}
+}
+
+// Close はバッファに残っているものをすべて書き出し、バックグラウンドでの書き出しを終了します。
+func (b *bufferedOutput) Close() error {
+	b.policy.mu.Lock()
+	delete(b.policy.outputs, b)
+	b.policy.mu.Unlock()
+	close(b.done)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.complete = b.buf.Len()
+	return b.flush()
+}
+
+// handleSignals は SIGINT と SIGTERM を受け取ったときの終了処理を設定します。
+// stop が nil でなければ (-f)、stop を閉じて入力の終わりとして扱い、通常どおり出力と統計を書き出して終了させます。
+// そうでなければ、完結したレコードまでの出力を書き出してから、シグナルに応じた終了コードで終了します。
+// 2回目のシグナルでは、通常どおりすぐに終了します。
+func handleSignals(stop chan struct{}, policy *flushPolicy) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		if stop != nil {
+			close(stop)
+			return
+		}
+		if policy != nil {
+			if err := policy.flushAll(); err != nil {
+				log.Printf("Warning: Could not write output: %v", err)
+			}
+		}
+		code := 130
+		if sig == syscall.SIGTERM {
+			code = 143
+		}
+		log.Printf("Received %v, exiting.", sig)
+		os.Exit(code)
+	}()
+}
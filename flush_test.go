@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer that can be read while a background flush writes to it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *lockedBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+func TestBufferedOutputPolicies(t *testing.T) {
+	t.Run("every-record", func(t *testing.T) {
+		var dst lockedBuffer
+		out := (&flushPolicy{mode: "every-record", size: 1024}).wrap(&dst)
+		out.Write([]byte("one\n"))
+		if dst.String() != "" {
+			t.Errorf("Expected nothing before the record is done, but got %q", dst.String())
+		}
+		out.recordDone()
+		if dst.String() != "one\n" {
+			t.Errorf("Expected the record to be written, but got %q", dst.String())
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		var dst lockedBuffer
+		out := (&flushPolicy{mode: "size", size: 8}).wrap(&dst)
+		out.Write([]byte("one\n"))
+		out.recordDone()
+		if dst.String() != "" {
+			t.Errorf("Expected the record to be buffered, but got %q", dst.String())
+		}
+		out.Write([]byte("two\n"))
+		out.recordDone()
+		out.Write([]byte("thr"))
+		if dst.String() != "one\ntwo\n" {
+			t.Errorf("Expected both records once the buffer is full, but got %q", dst.String())
+		}
+		if err := out.Close(); err != nil || dst.String() != "one\ntwo\nthr" {
+			t.Errorf("Expected everything after Close, but got %q (%v)", dst.String(), err)
+		}
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		var dst lockedBuffer
+		out := (&flushPolicy{mode: "interval", interval: 10 * time.Millisecond, size: 1024}).wrap(&dst)
+		defer out.Close()
+		out.Write([]byte("one\n"))
+		out.recordDone()
+		out.Write([]byte("tw"))
+		deadline := time.Now().Add(2 * time.Second)
+		for dst.String() == "" && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		// Only complete records are written, so readers never see half a line.
+		time.Sleep(30 * time.Millisecond)
+		if dst.String() != "one\n" {
+			t.Errorf("Expected only the complete record, but got %q", dst.String())
+		}
+	})
+}
+
+func TestFlushAll(t *testing.T) {
+	policy := &flushPolicy{mode: "size", size: 1024}
+	var a, b lockedBuffer
+	outA, outB := policy.wrap(&a), policy.wrap(&b)
+	outA.Write([]byte("a1\n"))
+	outA.recordDone()
+	outA.Write([]byte("a2"))
+	outB.Write([]byte("b1\n"))
+	outB.recordDone()
+	policy.flushAll()
+	if a.String() != "a1\n" || b.String() != "b1\n" {
+		t.Errorf("Expected the complete records of both outputs, but got %q and %q", a.String(), b.String())
+	}
+	outA.Close()
+	outB.Close()
+	if len(policy.outputs) != 0 {
+		t.Errorf("Expected closed outputs to be removed, but %d remain", len(policy.outputs))
+	}
+}
+
+func TestProcessInputsBuffered(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"a.jsonl": strings.Repeat(`{"user":"alice"}`+"\n", 100),
+		"b.jsonl": strings.Repeat(`{"user":"bob"}`+"\n", 100),
+	})
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	opts := inputOptions{
+		formats:  ioFormats{input: "json"},
+		parallel: 2,
+		flush:    &flushPolicy{mode: "size", size: 256},
+	}
+	var out bytes.Buffer
+	if err := processInputs([]string{dir + "/a.jsonl", dir + "/b.jsonl"}, &out, opts, processor); err != nil {
+		t.Fatalf("processInputs failed: %v", err)
+	}
+	alice := strings.Count(out.String(), `{"dept":"Sales, EMEA","user":"alice"}`+"\n")
+	bob := strings.Count(out.String(), `{"dept":"Engineering","user":"bob"}`+"\n")
+	if alice != 100 || bob != 100 || strings.Count(out.String(), "\n") != 200 {
+		t.Errorf("Expected 100 whole records from each input, but got %d and %d:\n%s", alice, bob, out.String())
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// --- 追記されるファイルの追跡 (-f) ---
+
+// followHeadSize は、ファイルが入れ替わったかどうかを判定するために記録するファイル先頭のバイト数です。
+const followHeadSize = 64
+
+// follower は -f で入力ファイルを追跡する設定です。
+type follower struct {
+	interval time.Duration // 追記やローテーションを確認する間隔
+	stop     <-chan struct{}
+	state    *followState // nil の場合は読み込み位置を記録しない
+
+	// flush は読み込み位置を記録する前に、バッファリングした出力を書き出します (--flush)。
+	// 書き出していないレコードの位置を記録すると、異常終了した後の再開でそのレコードが失われるためです。
+	flush func() error
+}
+
+// newFollower は追跡の設定を作ります。statePath が空でなければ、状態ファイルから前回の読み込み位置を読み込みます。
+// stop が閉じられると (SIGINT または SIGTERM)、処理済みの位置を記録して入力の終わりとして扱います。
+func newFollower(interval time.Duration, statePath string, stop <-chan struct{}) (*follower, error) {
+	f := &follower{interval: interval, stop: stop}
+	if statePath != "" {
+		state, err := loadFollowState(statePath)
+		if err != nil {
+			return nil, err
+		}
+		f.state = state
+	}
+	return f, nil
+}
+
+// followCheckpoint は入力ファイルごとに記録する読み込み位置です。
+// Head はファイル先頭のバイト列で、再開時に同じファイルかどうかを確認するために使います。
+type followCheckpoint struct {
+	Offset int64  `json:"offset"`
+	Head   []byte `json:"head"`
+}
+
+// followState は --follow-state の状態ファイルで、入力ファイルの絶対パスごとに読み込み位置を保持します。
+type followState struct {
+	path string
+
+	mu          sync.Mutex
+	checkpoints map[string]followCheckpoint
+}
+
+// loadFollowState は状態ファイルを読み込みます。ファイルがない場合は空の状態から始めます。
+func loadFollowState(path string) (*followState, error) {
+	state := &followState{path: path, checkpoints: make(map[string]followCheckpoint)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, &state.checkpoints); err != nil {
+		return nil, fmt.Errorf("could not parse state file: %w", err)
+	}
+	return state, nil
+}
+
+func (s *followState) get(key string) (followCheckpoint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkpoint, ok := s.checkpoints[key]
+	return checkpoint, ok
+}
+
+// save は key の読み込み位置を更新し、状態ファイルを書き直します。
+// 書き込み途中で終了しても壊れたファイルが残らないよう、一時ファイルに書いてから置き換えます。
+func (s *followState) save(key string, checkpoint followCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[key] = checkpoint
+	data, err := json.Marshal(s.checkpoints)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("could not write state file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("could not write state file: %w", err)
+	}
+	return nil
+}
+
+// followReader は tail -F のように、追記される入力ファイルを読み続ける io.Reader です。
+//
+// ファイルの終わりに達すると interval ごとに追記を待ち、パスのファイルが入れ替わった場合 (ローテーション) は
+// 古いファイルを読み切ってから新しいファイルを先頭から、切り詰められた場合は先頭から読み直します。
+// stop が閉じられると io.EOF を返します。
+//
+// 呼び出し側には改行で終わる行だけを渡し、書き込み途中の行は改行が追記されるまで保留します。
+// レコードの読み込み (bufio.Scanner など) は、渡された行をすべて処理してから次の Read を呼ぶため、
+// Read が呼ばれた時点で渡し終えた行までを処理済みの位置として状態ファイルに記録します。
+type followReader struct {
+	*follower
+	path string
+	key  string // 状態ファイルでのキー (絶対パス)
+
+	file     *os.File
+	info     os.FileInfo
+	offset   int64  // 現在のファイルから読み込んだバイト数
+	pending  []byte // 読み込んだが、まだ渡していないバイト列
+	consumed int64  // 渡し終えた最後の行の、現在のファイルでの終わりの位置
+	head     []byte
+	saved    int64 // 最後に状態ファイルに記録した consumed
+	savedAt  time.Time
+	chunk    []byte
+}
+
+// open は path の追跡を始めます。状態ファイルに同じファイルの読み込み位置があれば、そこから再開します。
+func (f *follower) open(path string) (*followReader, error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &followReader{follower: f, path: path, key: key, saved: -1, chunk: make([]byte, 32*1024)}
+	if err := r.reopen(); err != nil {
+		return nil, fmt.Errorf("could not open input: %w", err)
+	}
+	if f.state == nil {
+		return r, nil
+	}
+	checkpoint, ok := f.state.get(key)
+	if !ok || checkpoint.Offset == 0 {
+		return r, nil
+	}
+	if r.info.Size() < checkpoint.Offset || !bytes.Equal(r.readHead(len(checkpoint.Head)), checkpoint.Head) {
+		log.Printf("Warning: %s was rotated or truncated since the last run, reading it from the beginning.", path)
+		return r, nil
+	}
+	if _, err := r.file.Seek(checkpoint.Offset, io.SeekStart); err != nil {
+		r.file.Close()
+		return nil, fmt.Errorf("could not resume input: %w", err)
+	}
+	r.offset, r.consumed, r.saved, r.head = checkpoint.Offset, checkpoint.Offset, checkpoint.Offset, checkpoint.Head
+	return r, nil
+}
+
+// reopen はパスのファイルを開き直し、先頭から読みます。
+func (r *followReader) reopen() error {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if r.file != nil {
+		r.file.Close()
+	}
+	r.file, r.info = file, info
+	r.offset, r.consumed, r.head = 0, 0, nil
+	return nil
+}
+
+// readHead は現在のファイルの先頭から最大 n バイトを返します。
+func (r *followReader) readHead(n int) []byte {
+	head := make([]byte, n)
+	read, _ := r.file.ReadAt(head, 0)
+	return head[:read]
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	r.checkpoint(false)
+	for {
+		if n := r.deliver(p); n > 0 {
+			return n, nil
+		}
+		select {
+		case <-r.stop:
+			// 保留中の行は処理済みの位置に含まれないため、再開時に読み直されます。
+			r.checkpoint(true)
+			return 0, io.EOF
+		default:
+		}
+		n, err := r.file.Read(r.chunk)
+		if n > 0 {
+			r.pending = append(r.pending, r.chunk[:n]...)
+			r.offset += int64(n)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("could not read %s: %w", r.path, err)
+		}
+		switched, err := r.checkRotation()
+		if err != nil {
+			return 0, err
+		}
+		if switched {
+			continue
+		}
+
+		r.checkpoint(true)
+		select {
+		case <-r.stop:
+			return 0, io.EOF
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// deliver は保留中のバイト列のうち、p に収まる完結した行を p に移します。
+// 1行が p より長い場合は、行の途中までを渡します。
+func (r *followReader) deliver(p []byte) int {
+	window := r.pending[:min(len(r.pending), len(p))]
+	end := bytes.LastIndexByte(window, '\n') + 1
+	if end == 0 && len(r.pending) >= len(p) {
+		end = len(p)
+	}
+	if end == 0 {
+		return 0
+	}
+	n := copy(p, r.pending[:end])
+	r.pending = r.pending[end:]
+	if p[n-1] == '\n' {
+		// ローテーション前のファイルの残りを渡している間は、新しいファイルの位置は進みません。
+		r.consumed = max(r.offset-int64(len(r.pending)), 0)
+	}
+	return n
+}
+
+// checkRotation はファイルの終わりで、パスのファイルが入れ替わったか切り詰められたかを確認し、
+// そうであれば読み直しを始めます。古いファイルの書き込み途中の行は、改行を補って渡します。
+func (r *followReader) checkRotation() (bool, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		// ローテーションで新しいファイルが作られるまでの間は、パスにファイルがないことがあります。
+		return false, nil
+	}
+	switch {
+	case !os.SameFile(r.info, info):
+		// 入れ替わる直前に古いファイルに追記された行を読み切ってから切り替えます。
+		rest, err := io.ReadAll(r.file)
+		if err != nil {
+			return false, fmt.Errorf("could not read %s: %w", r.path, err)
+		}
+		r.pending = append(r.pending, rest...)
+		if err := r.reopen(); err != nil {
+			return false, nil
+		}
+	case info.Size() < r.offset:
+		if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+			return false, fmt.Errorf("could not read %s: %w", r.path, err)
+		}
+		r.offset, r.consumed, r.head = 0, 0, nil
+	default:
+		return false, nil
+	}
+	if len(r.pending) > 0 && r.pending[len(r.pending)-1] != '\n' {
+		r.pending = append(r.pending, '\n')
+	}
+	log.Printf("%s was rotated or truncated, reading it from the beginning.", r.path)
+	return true, nil
+}
+
+// checkpoint は処理済みの位置を状態ファイルに記録します。
+// idle でなければ、書き込みの回数を抑えるため interval に1回までとします。
+func (r *followReader) checkpoint(idle bool) {
+	if r.state == nil || r.consumed == r.saved || (!idle && time.Since(r.savedAt) < r.interval) {
+		return
+	}
+	if r.flush != nil {
+		if err := r.flush(); err != nil {
+			log.Printf("Warning: Could not save the position of %s: %v", r.path, err)
+			return
+		}
+	}
+	if int64(len(r.head)) < min(r.consumed, followHeadSize) {
+		r.head = r.readHead(int(min(r.consumed, followHeadSize)))
+	}
+	if err := r.state.save(r.key, followCheckpoint{Offset: r.consumed, Head: r.head}); err != nil {
+		log.Printf("Warning: Could not save the position of %s: %v", r.path, err)
+		return
+	}
+	r.saved, r.savedAt = r.consumed, time.Now()
+}
+
+func (r *followReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startFollowing reads lines from a followReader in the background, as processInput does.
+func startFollowing(t *testing.T, f *follower, path string) (<-chan string, <-chan struct{}) {
+	t.Helper()
+	reader, err := f.open(path)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	lines := make(chan string, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer reader.Close()
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return lines, done
+}
+
+func expectLines(t *testing.T, lines <-chan string, expected ...string) {
+	t.Helper()
+	for _, want := range expected {
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Fatalf("Expected line %q, but got %q", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for line %q", want)
+		}
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestFollowReaderRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "one\n")
+	stop := make(chan struct{})
+	state, _ := loadFollowState(filepath.Join(dir, "state.json"))
+	lines, done := startFollowing(t, &follower{interval: 10 * time.Millisecond, stop: stop, state: state}, path)
+	expectLines(t, lines, "one")
+
+	// A line is passed on only once its newline has been written.
+	appendFile(t, path, "two\nthr")
+	expectLines(t, lines, "two")
+	appendFile(t, path, "ee\n")
+	expectLines(t, lines, "three")
+
+	// Rotation: the rest of the old file (including an unfinished line) is read before the new file.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	appendFile(t, path+".1", "four\nfi")
+	appendFile(t, path, "six\n")
+	expectLines(t, lines, "four", "fi", "six")
+
+	// Truncation: the file is read again from the beginning.
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, path, "seven\n")
+	expectLines(t, lines, "seven")
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the reader to stop")
+	}
+	checkpoint, ok := state.get(filepath.Join(dir, "app.log"))
+	if !ok || checkpoint.Offset != 6 || string(checkpoint.Head) != "seven\n" {
+		t.Errorf("Expected a checkpoint at offset 6, but got %+v", checkpoint)
+	}
+}
+
+func TestFollowReaderResume(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	statePath := filepath.Join(dir, "state.json")
+	appendFile(t, path, "one\ntwo\n")
+
+	run := func(expected ...string) {
+		t.Helper()
+		state, err := loadFollowState(statePath)
+		if err != nil {
+			t.Fatalf("loadFollowState failed: %v", err)
+		}
+		stop := make(chan struct{})
+		lines, done := startFollowing(t, &follower{interval: 10 * time.Millisecond, stop: stop, state: state}, path)
+		expectLines(t, lines, expected...)
+		time.Sleep(50 * time.Millisecond)
+		close(stop)
+		<-done
+		if len(lines) != 0 {
+			t.Errorf("Unexpected line %q", <-lines)
+		}
+	}
+
+	run("one", "two")
+	// The restarted reader continues after the lines that were already read.
+	appendFile(t, path, "three\n")
+	run("three")
+
+	// A different file at the same path is read from the beginning.
+	if err := os.WriteFile(path, []byte("new file with longer lines\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	run("new file with longer lines")
+
+	data, err := os.ReadFile(statePath)
+	if err != nil || !bytes.Contains(data, []byte(`"offset":27`)) {
+		t.Errorf("Expected the state file to record offset 27, but got %s (%v)", data, err)
+	}
+}
+
+func TestProcessInputsFollow(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.jsonl")
+	appendFile(t, path, `{"user":"alice"}`+"\n")
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	stop := make(chan struct{})
+	opts := inputOptions{
+		formats:   ioFormats{input: "json"},
+		outputDir: filepath.Join(dir, "out"),
+		follow:    &follower{interval: 10 * time.Millisecond, stop: stop},
+	}
+	done := make(chan error)
+	go func() {
+		done <- processInputs([]string{path}, &bytes.Buffer{}, opts, processor)
+	}()
+
+	// Each record is written as soon as its line is read.
+	output := filepath.Join(dir, "out", "app.jsonl")
+	waitFor := func(expected string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			data, _ := os.ReadFile(output)
+			if string(data) == expected {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected output:\n%s\nbut got:\n%s", expected, data)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	first := `{"dept":"Sales, EMEA","user":"alice"}` + "\n"
+	waitFor(first)
+	appendFile(t, path, `{"user":"bob"}`+"\n")
+	waitFor(first + `{"dept":"Engineering","user":"bob"}` + "\n")
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("processInputs failed: %v", err)
+	}
+	if data, _ := os.ReadFile(output); strings.Count(string(data), "\n") != 2 {
+		t.Errorf("Expected 2 records, but got:\n%s", data)
+	}
+}
+
+func TestFollowCheckpointAfterFlush(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.jsonl")
+	statePath := filepath.Join(dir, "state.json")
+	appendFile(t, path, `{"user":"alice"}`+"\n")
+	state, err := loadFollowState(statePath)
+	if err != nil {
+		t.Fatalf("loadFollowState failed: %v", err)
+	}
+	stop := make(chan struct{})
+	// The size is never reached, so only the flush before each checkpoint writes the record.
+	policy := &flushPolicy{mode: "size", size: 1 << 20}
+	follow := &follower{interval: 10 * time.Millisecond, stop: stop, state: state, flush: policy.flushAll}
+	opts := inputOptions{formats: ioFormats{input: "json"}, follow: follow, flush: policy}
+	var out lockedBuffer
+	done := make(chan error)
+	go func() {
+		done <- processInputs([]string{path}, &out, opts, newTestProcessor(t, "user as name OUTPUT dept"))
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(statePath)
+		if bytes.Contains(data, []byte(`"offset":17`)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the checkpoint, state file: %s", data)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// A saved position must never cover records that have not been written yet.
+	if out.String() != `{"dept":"Sales, EMEA","user":"alice"}`+"\n" {
+		t.Errorf("Expected the record to be written before its position was saved, but got %q", out.String())
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("processInputs failed: %v", err)
+	}
+}
@@ -1,3 +1,11 @@
 module github.com/magifd2/lookup-go
 
 go 1.25.0
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	go.etcd.io/bbolt v1.4.3
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.29.0 // indirect
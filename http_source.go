@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- HTTP/REST API データソース ---
+
+// HTTPSourceConfig は type が "http" のデータソースの設定を表します。
+type HTTPSourceConfig struct {
+	URL         string            `json:"url"`                   // 例: "https://cmdb/api/hosts/{value}"
+	Method      string            `json:"method,omitempty"`      // 既定値は "GET"
+	Headers     map[string]string `json:"headers,omitempty"`     // 値の ${VAR} は設定の読み込み時に展開されます
+	Body        string            `json:"body,omitempty"`        // リクエストボディのテンプレート
+	Fields      map[string]string `json:"fields,omitempty"`      // Key: 出力フィールド名, Value: レスポンスJSONのパス
+	Timeout     string            `json:"timeout,omitempty"`     // 1リクエストあたりのタイムアウト (既定値 "10s")
+	Retries     int               `json:"retries,omitempty"`     // 失敗時の再試行回数
+	Concurrency int               `json:"concurrency,omitempty"` // 同時リクエスト数の上限 (既定値 4)
+	CacheSize   int               `json:"cache_size,omitempty"`  // キャッシュする値の最大数 (既定値 10000)
+	CacheTTL    string            `json:"cache_ttl,omitempty"`   // キャッシュの有効期間 (既定値 "10m")
+}
+
+const (
+	defaultHTTPTimeout     = 10 * time.Second
+	defaultHTTPConcurrency = 4
+	defaultHTTPCacheSize   = 10000
+	defaultHTTPCacheTTL    = 10 * time.Minute
+	httpRetryBaseDelay     = 200 * time.Millisecond
+	maxHTTPResponseSize    = 10 << 20
+)
+
+// httpLookuper はREST APIへの問い合わせ結果をルックアップ結果として返します。
+type httpLookuper struct {
+	config    *HTTPSourceConfig
+	client    *http.Client
+	method    string
+	headers   map[string]string
+	retries   int
+	semaphore chan struct{}
+	cache     *lookupCache
+}
+
+// newHTTPLookuper は設定を検証し、httpLookuper を生成します。
+func newHTTPLookuper(config *HTTPSourceConfig) (*httpLookuper, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("http.url is required")
+	}
+	if !strings.HasPrefix(config.URL, "http://") && !strings.HasPrefix(config.URL, "https://") {
+		return nil, fmt.Errorf("http.url must start with http:// or https://: %s", config.URL)
+	}
+	if config.Retries < 0 {
+		return nil, fmt.Errorf("http.retries must not be negative")
+	}
+
+	timeout, err := parseDurationOrDefault(config.Timeout, defaultHTTPTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http.timeout: %w", err)
+	}
+	cacheTTL, err := parseDurationOrDefault(config.CacheTTL, defaultHTTPCacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http.cache_ttl: %w", err)
+	}
+
+	method := strings.ToUpper(config.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultHTTPConcurrency
+	}
+	cacheSize := config.CacheSize
+	if cacheSize == 0 {
+		cacheSize = defaultHTTPCacheSize
+	}
+
+	return &httpLookuper{
+		config:    config,
+		client:    &http.Client{Timeout: timeout},
+		method:    method,
+		headers:   config.Headers,
+		retries:   config.Retries,
+		semaphore: make(chan struct{}, concurrency),
+		cache:     newLookupCache(cacheSize, cacheTTL),
+	}, nil
+}
+
+// Lookup はキャッシュを確認し、なければAPIに問い合わせます。
+// 404 Not Found は「一致なし」として扱い、キャッシュします。
+func (h *httpLookuper) Lookup(value string) (map[string]string, error) {
+	if result, ok := h.cache.get(value); ok {
+		return result, nil
+	}
+
+	h.semaphore <- struct{}{}
+	defer func() { <-h.semaphore }()
+
+	var result map[string]string
+	var err error
+	for attempt := 0; attempt <= h.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(httpRetryBaseDelay << (attempt - 1))
+		}
+		var retryable bool
+		result, retryable, err = h.fetch(value)
+		if err == nil || !retryable {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.cache.put(value, result)
+	return result, nil
+}
+
+// Explain はAPIの問い合わせ結果を説明します。キャッシュから返した場合は index が "cache" になります。
+func (h *httpLookuper) Explain(value string) (map[string]string, *lookupExplanation, error) {
+	ex := &lookupExplanation{Source: "http", NormalizedValue: value}
+	hits, _ := h.cache.stats()
+	result, err := h.Lookup(value)
+	if err != nil {
+		return nil, ex, err
+	}
+	if after, _ := h.cache.stats(); after > hits {
+		ex.Index = "cache"
+	}
+	ex.finish(result != nil, "API returned no record")
+	return result, ex, nil
+}
+
+// cacheStats はキャッシュのヒット数とミス数を返します。
+func (h *httpLookuper) cacheStats() (hits, misses int64, ok bool) {
+	hits, misses = h.cache.stats()
+	return hits, misses, true
+}
+
+// fetch は1回分のHTTPリクエストを実行します。
+// 戻り値の bool は、エラーが再試行可能かどうかを示します。
+func (h *httpLookuper) fetch(value string) (map[string]string, bool, error) {
+	var body io.Reader
+	if h.config.Body != "" {
+		body = strings.NewReader(expandBodyTemplate(h.config.Body, value))
+	}
+	req, err := http.NewRequest(h.method, expandURLTemplate(h.config.URL, value), body)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, v := range h.headers {
+		req.Header.Set(name, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return nil, true, fmt.Errorf("unexpected status: %s", resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	respBytes, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseSize))
+	if err != nil {
+		return nil, true, fmt.Errorf("could not read response: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(respBytes))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false, fmt.Errorf("could not parse response JSON: %w", err)
+	}
+	return mapResponseFields(doc, h.config.Fields), false, nil
+}
+
+// mapResponseFields はレスポンスJSONから設定されたパスの値を取り出します。
+// fields が空の場合は、トップレベルのすべてのフィールドを返します。
+func mapResponseFields(doc interface{}, fields map[string]string) map[string]string {
+	result := make(map[string]string)
+	if len(fields) == 0 {
+		if obj, ok := doc.(map[string]interface{}); ok {
+			for k, v := range obj {
+				result[k] = stringifyJSONValue(v)
+			}
+		}
+		return result
+	}
+	for outputField, path := range fields {
+		if v, ok := extractJSONPath(doc, path); ok {
+			result[outputField] = stringifyJSONValue(v)
+		}
+	}
+	return result
+}
+
+var jsonPathIndexPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// extractJSONPath は "data.owner.name" や "$.items[0].id" 形式のパスで値を取り出します。
+func extractJSONPath(doc interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = jsonPathIndexPattern.ReplaceAllString(path, ".$1")
+	current := doc
+	if path == "" {
+		return current, true
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			v, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// stringifyJSONValue はJSONの値を出力用の文字列に変換します。
+// オブジェクトや配列はJSON文字列として返します。
+func stringifyJSONValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%v", val)
+		}
+		return string(b)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// expandURLTemplate はURL中の {value} を、予約文字をすべてエスケープした値で置換します。
+func expandURLTemplate(tmpl, value string) string {
+	return strings.ReplaceAll(tmpl, "{value}", escapeURLValue(value))
+}
+
+// expandBodyTemplate はボディ中の {value} を、JSON文字列としてエスケープした値で置換します。
+func expandBodyTemplate(tmpl, value string) string {
+	quoted, _ := json.Marshal(value)
+	return strings.ReplaceAll(tmpl, "{value}", string(quoted[1:len(quoted)-1]))
+}
+
+// escapeURLValue は RFC 3986 の非予約文字以外をすべてパーセントエンコードします。
+// パスとクエリのどちらに埋め込まれても、値が構造を変えないようにするためです。
+func escapeURLValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// parseDurationOrDefault は空文字列の場合に既定値を返す time.ParseDuration です。
+func parseDurationOrDefault(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// --- ルックアップ結果のキャッシュ ---
+
+// lookupCache はTTL付きのLRUキャッシュです。一致なし (nil) の結果もキャッシュします。
+type lookupCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+
+	hits, misses int64 // --stats で報告する get の結果の集計
+}
+
+type lookupCacheEntry struct {
+	key     string
+	value   map[string]string
+	expires time.Time
+}
+
+// newLookupCache はキャッシュを生成します。size が負の場合はキャッシュを無効にします。
+func newLookupCache(size int, ttl time.Duration) *lookupCache {
+	return &lookupCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *lookupCache) get(key string) (map[string]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	entry := elem.Value.(*lookupCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		c.misses++
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	c.hits++
+	return entry.value, true
+}
+
+// stats はこれまでの get のヒット数とミス数を返します。
+func (c *lookupCache) stats() (hits, misses int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+func (c *lookupCache) put(key string, value map[string]string) {
+	if c.size < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+	}
+	c.entries[key] = c.order.PushFront(&lookupCacheEntry{key: key, value: value, expires: time.Now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lookupCacheEntry).key)
+	}
+}
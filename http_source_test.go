@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPLookuper(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/hosts/web01":
+			w.Write([]byte(`{"data":{"owner":{"name":"alice"},"tags":["prod","web"],"id":12345678901234567890}}`))
+		case "/hosts/a%2Fb":
+			w.Write([]byte(`{"data":{"owner":{"name":"escaped"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	lookuper, err := newHTTPLookuper(&HTTPSourceConfig{
+		URL:     server.URL + "/hosts/{value}",
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+		Fields: map[string]string{
+			"owner":     "data.owner.name",
+			"first_tag": "$.data.tags[0]",
+			"asset_id":  "data.id",
+		},
+	})
+	if err != nil {
+		t.Fatalf("newHTTPLookuper failed: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		value    string
+		expected map[string]string
+	}{
+		{
+			name:  "Mapped fields",
+			value: "web01",
+			expected: map[string]string{
+				"owner":     "alice",
+				"first_tag": "prod",
+				"asset_id":  "12345678901234567890",
+			},
+		},
+		{
+			name:     "Value is path-escaped",
+			value:    "a/b",
+			expected: map[string]string{"owner": "escaped"},
+		},
+		{
+			name:     "Not found",
+			value:    "unknown",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := lookuper.Lookup(tc.value)
+			if err != nil {
+				t.Fatalf("Lookup failed: %v", err)
+			}
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected %v, but got %v", tc.expected, result)
+			}
+		})
+	}
+
+	// Repeated lookups must be served from the cache.
+	before := atomic.LoadInt32(&requests)
+	if _, err := lookuper.Lookup("web01"); err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if _, err := lookuper.Lookup("unknown"); err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if after := atomic.LoadInt32(&requests); after != before {
+		t.Errorf("Expected cached results, but %d new requests were made", after-before)
+	}
+}
+
+func TestHTTPLookuperRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"name":"ok"}`))
+	}))
+	defer server.Close()
+
+	lookuper, err := newHTTPLookuper(&HTTPSourceConfig{URL: server.URL + "/{value}", Retries: 2})
+	if err != nil {
+		t.Fatalf("newHTTPLookuper failed: %v", err)
+	}
+	result, err := lookuper.Lookup("x")
+	if err != nil {
+		t.Fatalf("Lookup failed after retries: %v", err)
+	}
+	if result["name"] != "ok" {
+		t.Errorf("Expected name=ok, but got %v", result)
+	}
+
+	noRetry, err := newHTTPLookuper(&HTTPSourceConfig{URL: server.URL + "/{value}", Timeout: "1s"})
+	if err != nil {
+		t.Fatalf("newHTTPLookuper failed: %v", err)
+	}
+	atomic.StoreInt32(&requests, 0)
+	if _, err := noRetry.Lookup("y"); err == nil {
+		t.Error("Expected an error without retries, but got nil")
+	}
+}
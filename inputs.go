@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// --- 入力ファイル (位置引数) ---
+
+// lineNumberField は --annotate でレコードの入力での行番号を記録するフィールド名です。
+// 入力のファイル名はデータソースの行と同じ _source_file (sourceFileField) に記録します。
+const lineNumberField = "_line_number"
+
+// inputOptions は複数の入力の処理方法です。
+type inputOptions struct {
+	formats   ioFormats
+	outputDir string       // 空でなければ、入力ごとに同じ名前のファイルをこのディレクトリに書き出す
+	parallel  int          // 同時に処理する入力の数
+	follow    *follower    // nil でなければ、入力ファイルへの追記を読み続ける (-f)
+	flush     *flushPolicy // nil でなければ、出力をこの方針でバッファリングする
+}
+
+// recordFlusher は、レコードを1件書き出すごとに processInput から通知を受ける出力先が実装します。
+type recordFlusher interface {
+	recordDone() error
+}
+
+// expandInputArgs は位置引数のファイル、glob、"-" (標準入力) を入力のパスの一覧にします。
+// 引数がない場合は標準入力のみです。glob に一致するファイルがない場合はエラーとします。
+func expandInputArgs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{"-"}, nil
+	}
+	var paths []string
+	for _, arg := range args {
+		if arg == "-" || !strings.ContainsAny(arg, "*?[") {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern '%s': %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match '%s'", arg)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// checkOutputDir は --output-dir に書き出せる入力かどうかを確認します。
+// 標準入力、同じ名前の入力の重複、入力ファイル自体を上書きする指定はエラーとします。
+func checkOutputDir(paths []string, outputDir string) error {
+	seen := make(map[string]string, len(paths))
+	for _, path := range paths {
+		if path == "-" {
+			return fmt.Errorf("--output-dir cannot be used with standard input ('-')")
+		}
+		name := filepath.Base(path)
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("inputs '%s' and '%s' would both be written to '%s'", other, path, name)
+		}
+		seen[name] = path
+		in, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		out, err := filepath.Abs(filepath.Join(outputDir, name))
+		if err != nil {
+			return err
+		}
+		if in == out {
+			return fmt.Errorf("output for '%s' would overwrite the input file", path)
+		}
+	}
+	return nil
+}
+
+// processInputs は入力を順に (parallel が2以上であれば並列に) 処理します。
+// 出力は stdout に書き出し、outputDir が指定されていれば入力ごとのファイルに書き出します。
+// ある入力でエラーが起きても残りの入力は処理し、すべてのエラーをまとめて返します。
+func processInputs(paths []string, stdout io.Writer, opts inputOptions, processor *recordProcessor) (err error) {
+	if opts.outputDir != "" {
+		if err := checkOutputDir(paths, opts.outputDir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(opts.outputDir, 0700); err != nil {
+			return fmt.Errorf("could not create output directory: %w", err)
+		}
+	}
+	parallel := max(opts.parallel, 1)
+	if opts.follow != nil {
+		// 追跡する入力は終わらないため、すべての入力を同時に処理します。
+		parallel = len(paths)
+	}
+
+	if opts.flush != nil && opts.outputDir == "" {
+		buffered := opts.flush.wrap(stdout)
+		defer func() {
+			if closeErr := buffered.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("could not write output: %w", closeErr)
+			}
+		}()
+		stdout = buffered
+	}
+
+	var (
+		wg       sync.WaitGroup
+		stdoutMu sync.Mutex
+		errMu    sync.Mutex
+		errs     []error
+	)
+	slots := make(chan struct{}, parallel)
+	for _, path := range paths {
+		slots <- struct{}{}
+		errMu.Lock()
+		failed := len(errs) > 0
+		errMu.Unlock()
+		if failed && processor.onError != nil && processor.onError.mode == "fail" {
+			// --on-error fail では、エラーの後に残りの入力を処理し始めません。
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			var output io.Writer = stdout
+			if parallel > 1 {
+				output = &syncedOutput{mu: &stdoutMu, dst: stdout}
+			}
+			if err := processPath(path, output, opts, processor); err != nil {
+				errMu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", path, err))
+				errMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// processPath は1つの入力を処理します。
+func processPath(path string, output io.Writer, opts inputOptions, processor *recordProcessor) (err error) {
+	var input io.Reader = os.Stdin
+	if path != "-" && opts.follow != nil {
+		reader, err := opts.follow.open(path)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		input = reader
+	} else if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("could not open input: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+	if opts.outputDir != "" {
+		mode := os.O_TRUNC
+		if opts.follow != nil {
+			// 追跡を再開した場合に前回までの出力を残すよう、追記します。
+			mode = os.O_APPEND
+		}
+		file, err := os.OpenFile(filepath.Join(opts.outputDir, filepath.Base(path)), os.O_WRONLY|os.O_CREATE|mode, 0600)
+		if err != nil {
+			return fmt.Errorf("could not create output file: %w", err)
+		}
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("could not write output file: %w", closeErr)
+			}
+		}()
+		output = file
+		if opts.flush != nil {
+			buffered := opts.flush.wrap(file)
+			defer func() {
+				if closeErr := buffered.Close(); closeErr != nil && err == nil {
+					err = fmt.Errorf("could not write output file: %w", closeErr)
+				}
+			}()
+			output = buffered
+		}
+	}
+	return processInput(input, path, output, opts.formats, processor)
+}
+
+// syncedOutput は並列に処理する入力の出力を、1つの出力先にまとめます。
+// レコードごとにまとめて書き出すため、異なる入力のレコードが行の途中で混ざることはありません。
+type syncedOutput struct {
+	mu  *sync.Mutex
+	dst io.Writer
+	buf bytes.Buffer
+}
+
+func (s *syncedOutput) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+func (s *syncedOutput) recordDone() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.dst.Write(s.buf.Bytes())
+	s.buf.Reset()
+	if err != nil {
+		return err
+	}
+	return recordDone(s.dst)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeInputFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestExpandInputArgs(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{"a.jsonl": "", "b.jsonl": "", "c.csv": ""})
+	paths, err := expandInputArgs([]string{filepath.Join(dir, "*.jsonl"), "-", "plain.json"})
+	if err != nil {
+		t.Fatalf("expandInputArgs failed: %v", err)
+	}
+	expected := []string{filepath.Join(dir, "a.jsonl"), filepath.Join(dir, "b.jsonl"), "-", "plain.json"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected %v, but got %v", expected, paths)
+	}
+	if paths, _ := expandInputArgs(nil); !reflect.DeepEqual(paths, []string{"-"}) {
+		t.Errorf("Expected stdin without arguments, but got %v", paths)
+	}
+	if _, err := expandInputArgs([]string{filepath.Join(dir, "*.xml")}); err == nil {
+		t.Error("Expected an error for a glob without matches")
+	}
+}
+
+func TestCheckOutputDir(t *testing.T) {
+	testCases := []struct {
+		paths    []string
+		dir      string
+		hasError bool
+	}{
+		{paths: []string{"logs/a.jsonl", "logs/b.jsonl"}, dir: "out"},
+		{paths: []string{"-"}, dir: "out", hasError: true},
+		{paths: []string{"x/a.jsonl", "y/a.jsonl"}, dir: "out", hasError: true},
+		{paths: []string{"logs/a.jsonl"}, dir: "logs", hasError: true},
+	}
+	for _, tc := range testCases {
+		err := checkOutputDir(tc.paths, tc.dir)
+		if (err != nil) != tc.hasError {
+			t.Errorf("checkOutputDir(%v, %q): expected error %v, but got %v", tc.paths, tc.dir, tc.hasError, err)
+		}
+	}
+}
+
+func TestProcessInputsAnnotate(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"a.jsonl": `{"user":"alice"}` + "\n\n" + `{"user":"bob"}` + "\n",
+		"b.json":  `[{"user":"x"},{"user":"bob"}]`,
+	})
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	processor.annotate = true
+	a, b := filepath.Join(dir, "a.jsonl"), filepath.Join(dir, "b.json")
+	var out bytes.Buffer
+	if err := processInputs([]string{a, b}, &out, inputOptions{formats: ioFormats{input: "json"}, parallel: 1}, processor); err != nil {
+		t.Fatalf("processInputs failed: %v", err)
+	}
+	// Blank lines are counted in JSON Lines; array elements are numbered from 1.
+	expected := `{"_line_number":1,"_source_file":"` + a + `","dept":"Sales, EMEA","user":"alice"}` + "\n" +
+		`{"_line_number":3,"_source_file":"` + a + `","dept":"Engineering","user":"bob"}` + "\n" +
+		"[\n  {\n    \"_line_number\": 1,\n    \"_source_file\": \"" + b + "\",\n    \"user\": \"x\"\n  },\n" +
+		"  {\n    \"_line_number\": 2,\n    \"_source_file\": \"" + b + "\",\n    \"dept\": \"Engineering\",\n    \"user\": \"bob\"\n  }\n]\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
+
+func TestProcessInputsOutputDir(t *testing.T) {
+	dir := writeInputFiles(t, map[string]string{
+		"a.csv": "user\nalice\n",
+		"b.csv": "user\nbob\nnobody\n",
+	})
+	outDir := filepath.Join(t.TempDir(), "enriched")
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	opts := inputOptions{formats: ioFormats{input: "csv", output: "csv"}, outputDir: outDir, parallel: 2}
+	var stdout bytes.Buffer
+	paths := []string{filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")}
+	if err := processInputs(paths, &stdout, opts, processor); err != nil {
+		t.Fatalf("processInputs failed: %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected nothing on stdout, but got %q", stdout.String())
+	}
+	for name, expected := range map[string]string{
+		"a.csv": "user,dept\nalice,\"Sales, EMEA\"\n",
+		"b.csv": "user,dept\nbob,Engineering\nnobody,\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if string(got) != expected {
+			t.Errorf("%s: expected:\n%s\nbut got:\n%s", name, expected, got)
+		}
+	}
+}
+
+func TestProcessInputsParallel(t *testing.T) {
+	files := map[string]string{}
+	var paths []string
+	for _, name := range []string{"a", "b", "c", "d"} {
+		files[name+".jsonl"] = strings.Repeat(`{"user":"bob","from":"`+name+`"}`+"\n", 200)
+	}
+	dir := writeInputFiles(t, files)
+	for name := range files {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	var out bytes.Buffer
+	if err := processInputs(append(paths, filepath.Join(dir, "missing.jsonl")), &out, inputOptions{formats: ioFormats{input: "json"}, parallel: 3}, processor); err == nil {
+		t.Error("Expected an error for the missing input")
+	}
+	// Records from different inputs may interleave, but each line is a whole record.
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 800 {
+		t.Fatalf("Expected 800 records, but got %d", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, `{"dept":"Engineering","from":"`) || !strings.HasSuffix(line, `","user":"bob"}`) {
+			t.Fatalf("Unexpected line: %s", line)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// --- キーバリューストア (bbolt) データソース ---
+
+var (
+	kvMetaBucket = []byte("meta")
+	kvRowsBucket = []byte("rows")
+)
+
+const (
+	kvMetaKeyField      = "key_field"
+	kvMetaCaseSensitive = "case_sensitive"
+	kvMetaSource        = "source"
+	kvMetaBuiltAt       = "built_at"
+	kvMetaRows          = "rows"
+
+	// kvBuildBatchSize は1トランザクションで書き込む行数です。
+	kvBuildBatchSize = 100000
+)
+
+// kvLookuper は build-index で作成したデータベースから完全一致の検索を行います。
+type kvLookuper struct {
+	db            *bolt.DB
+	caseSensitive bool
+}
+
+// newKVLookuper はデータベースを読み取り専用で開き、索引のキーが matcher と一致するか検証します。
+func newKVLookuper(path string, matcher *Matcher) (*kvLookuper, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open index: %w", err)
+	}
+
+	var keyField string
+	var caseSensitive bool
+	err = db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(kvMetaBucket)
+		if meta == nil || tx.Bucket(kvRowsBucket) == nil {
+			return fmt.Errorf("not a lookup-go index")
+		}
+		keyField = string(meta.Get([]byte(kvMetaKeyField)))
+		caseSensitive = string(meta.Get([]byte(kvMetaCaseSensitive))) == "true"
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("invalid index %s: %w", path, err)
+	}
+
+	if matcher.LookupField != keyField {
+		db.Close()
+		return nil, fmt.Errorf("index %s is keyed by '%s', but the matcher uses lookup_field '%s'", path, keyField, matcher.LookupField)
+	}
+	if matcher.CaseSensitive != caseSensitive {
+		db.Close()
+		return nil, fmt.Errorf("index %s was built with case_sensitive=%t, but the matcher uses case_sensitive=%t", path, caseSensitive, matcher.CaseSensitive)
+	}
+	if matcher.Method != "exact" {
+		log.Printf("Warning: kv data source only supports exact matching; method '%s' is ignored", matcher.Method)
+	}
+	return &kvLookuper{db: db, caseSensitive: caseSensitive}, nil
+}
+
+// Lookup はキーに対応する行を返します。
+func (k *kvLookuper) Lookup(value string) (map[string]string, error) {
+	key := value
+	if !k.caseSensitive {
+		key = strings.ToLower(key)
+	}
+	if key == "" {
+		return nil, nil
+	}
+	var row map[string]string
+	err := k.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(kvRowsBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read index: %w", err)
+	}
+	return row, nil
+}
+
+// Explain はキーで索引を引いた結果を説明します。
+func (k *kvLookuper) Explain(value string) (map[string]string, *lookupExplanation, error) {
+	ex := &lookupExplanation{Source: "kv", Method: "exact", CaseSensitive: &k.caseSensitive, Index: "key-value"}
+	ex.NormalizedValue = value
+	if !k.caseSensitive {
+		ex.NormalizedValue = strings.ToLower(value)
+	}
+	row, err := k.Lookup(value)
+	if err != nil {
+		return nil, ex, err
+	}
+	if row != nil {
+		ex.MatchedValue = ex.NormalizedValue
+	}
+	ex.finish(row != nil, "key not found in index")
+	return row, ex, nil
+}
+
+// Close はデータベースを閉じます。
+func (k *kvLookuper) Close() error {
+	return k.db.Close()
+}
+
+// buildKVIndex はデータソースを読み込み、keyField をキーとするデータベースを outPath に作成します。
+// 同じキーの行が複数ある場合は、findMatch と同様に最初の行を採用します。
+// 戻り値は書き込んだキーの数です。
+func buildKVIndex(sourcePath, keyField string, caseSensitive bool, outPath string) (int, error) {
+	tmpPath := outPath + ".tmp"
+	_ = os.Remove(tmpPath)
+	db, err := bolt.Open(tmpPath, 0600, &bolt.Options{Timeout: 5 * time.Second, NoSync: true})
+	if err != nil {
+		return 0, fmt.Errorf("could not create index: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	count := 0
+	var tx *bolt.Tx
+	var rows *bolt.Bucket
+	begin := func() error {
+		var err error
+		if tx, err = db.Begin(true); err != nil {
+			return err
+		}
+		rows, err = tx.CreateBucketIfNotExists(kvRowsBucket)
+		return err
+	}
+	if err := begin(); err != nil {
+		db.Close()
+		return 0, fmt.Errorf("could not create index: %w", err)
+	}
+
+	batch := 0
+	err = scanLookupData(sourcePath, func(row map[string]string) error {
+		key, ok := row[keyField]
+		if !ok || key == "" {
+			return nil
+		}
+		if !caseSensitive {
+			key = strings.ToLower(key)
+		}
+		if rows.Get([]byte(key)) != nil {
+			return nil
+		}
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if err := rows.Put([]byte(key), data); err != nil {
+			return err
+		}
+		count++
+		batch++
+		if batch >= kvBuildBatchSize {
+			batch = 0
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			return begin()
+		}
+		return nil
+	})
+	if err == nil {
+		err = writeKVMeta(tx, map[string]string{
+			kvMetaKeyField:      keyField,
+			kvMetaCaseSensitive: strconv.FormatBool(caseSensitive),
+			kvMetaSource:        sourcePath,
+			kvMetaBuiltAt:       time.Now().UTC().Format(time.RFC3339),
+			kvMetaRows:          strconv.Itoa(count),
+		})
+	}
+	if err != nil {
+		tx.Rollback()
+		db.Close()
+		return 0, fmt.Errorf("could not build index: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		db.Close()
+		return 0, fmt.Errorf("could not build index: %w", err)
+	}
+	if err := db.Sync(); err != nil {
+		db.Close()
+		return 0, fmt.Errorf("could not build index: %w", err)
+	}
+	if err := db.Close(); err != nil {
+		return 0, fmt.Errorf("could not build index: %w", err)
+	}
+	if err := os.Rename(tmpPath, outPath); err != nil {
+		return 0, fmt.Errorf("could not write index: %w", err)
+	}
+	return count, nil
+}
+
+func writeKVMeta(tx *bolt.Tx, values map[string]string) error {
+	meta, err := tx.CreateBucketIfNotExists(kvMetaBucket)
+	if err != nil {
+		return err
+	}
+	for k, v := range values {
+		if err := meta.Put([]byte(k), []byte(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- build-index サブコマンド ---
+
+// handleBuildIndex は build-index サブコマンドの引数を処理し、実行します。
+func handleBuildIndex() {
+	cmd := flag.NewFlagSet("build-index", flag.ExitOnError)
+	configPath := cmd.String("c", "", "Path to the lookup configuration file of the source data.")
+	lookupField := cmd.String("lookup-field", "", "The lookup_field of the matcher to index.")
+	outPath := cmd.String("o", "", "Path of the index file to create.")
+	cmd.Parse(os.Args[2:])
+
+	if *configPath == "" || *lookupField == "" || *outPath == "" {
+		log.Fatal("Error: -c, -lookup-field and -o flags are required for build-index command.")
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Error loading config file: %v", err)
+	}
+	if config.Type != "" && config.Type != "file" {
+		log.Fatalf("Error: build-index requires a file data source, but the config has type '%s'", config.Type)
+	}
+
+	var matcher *Matcher
+	for i := range config.Matchers {
+		m := &config.Matchers[i]
+		if m.LookupField == *lookupField && m.Method == "exact" {
+			matcher = m
+			break
+		}
+	}
+	if matcher == nil {
+		log.Fatalf("Error: No exact matcher found in config for lookup_field='%s'", *lookupField)
+	}
+
+	sourcePath, err := resolveConfiguredDataSource(*configPath, config)
+	if err != nil {
+		log.Fatalf("Error loading data source: %v", err)
+	}
+	if isMultiFileSource(sourcePath) {
+		log.Fatal("Error: build-index does not support directory or glob data sources.")
+	}
+
+	start := time.Now()
+	count, err := buildKVIndex(sourcePath, matcher.LookupField, matcher.CaseSensitive, *outPath)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Printf("Indexed %d keys from %s into %s in %s", count, filepath.Base(sourcePath), *outPath, time.Since(start).Round(time.Millisecond))
+}
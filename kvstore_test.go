@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestKVIndex(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "users.db")
+	count, err := buildKVIndex("testdata/users.csv", "username", false, dbPath)
+	if err != nil {
+		t.Fatalf("buildKVIndex failed: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("Expected 4 keys, but got %d", count)
+	}
+
+	lookuper, err := newKVLookuper(dbPath, &Matcher{LookupField: "username", Method: "exact"})
+	if err != nil {
+		t.Fatalf("newKVLookuper failed: %v", err)
+	}
+	defer lookuper.Close()
+
+	result, err := lookuper.Lookup("JDOE")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	expected := map[string]string{
+		"username":   "jdoe",
+		"department": "Sales",
+		"role":       "Manager",
+		"building":   "A",
+		"ip_range":   "192.168.1.10",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, but got %v", expected, result)
+	}
+
+	if result, err := lookuper.Lookup("nobody"); err != nil || result != nil {
+		t.Errorf("Expected no match, but got %v (err: %v)", result, err)
+	}
+}
+
+func TestKVIndexMatcherMismatch(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "users.db")
+	if _, err := buildKVIndex("testdata/users.csv", "username", false, dbPath); err != nil {
+		t.Fatalf("buildKVIndex failed: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		matcher *Matcher
+	}{
+		{name: "Different lookup_field", matcher: &Matcher{LookupField: "role", Method: "exact"}},
+		{name: "Different case sensitivity", matcher: &Matcher{LookupField: "username", Method: "exact", CaseSensitive: true}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lookuper, err := newKVLookuper(dbPath, tc.matcher)
+			if err == nil {
+				lookuper.Close()
+				t.Fatal("Expected an error, but got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// --- logfmt (key=value) ---
+
+// logfmtRecordReader は1行1レコードの logfmt (`ts=... user=alice msg="login ok"`) を読み込みます。
+// 値はすべて文字列になります。値のないキー (`debug`) は null として扱い、出力でもそのまま書き出します。
+type logfmtRecordReader struct {
+	scanner *lineScanner
+	line    int
+}
+
+func newLogfmtRecordReader(input io.Reader) *logfmtRecordReader {
+	return &logfmtRecordReader{scanner: newLineScanner(input)}
+}
+
+func (r *logfmtRecordReader) Read() (*inputRecord, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Text()
+		if r.scanner.tooLong {
+			return nil, &recordError{format: "logfmt", raw: line, line: r.line, err: errLineTooLong}
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rec, err := parseLogfmt(line)
+		if err != nil {
+			return nil, &recordError{format: "logfmt", raw: line, line: r.line, err: err}
+		}
+		rec.line = r.line
+		return rec, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read input: %w", err)
+	}
+	return nil, io.EOF
+}
+
+// parseLogfmt は1行の logfmt をキーの出現順とともに解析します。
+func parseLogfmt(line string) (*inputRecord, error) {
+	rec := &inputRecord{fields: make(map[string]interface{})}
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= len(line) {
+			return rec, nil
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			if line[i] == '"' {
+				return nil, fmt.Errorf("unexpected quote in key at column %d", i+1)
+			}
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("missing key at column %d", start+1)
+		}
+
+		var value interface{}
+		if i < len(line) && line[i] == '=' {
+			i++
+			if i < len(line) && line[i] == '"' {
+				end := i + 1
+				for end < len(line) && line[end] != '"' {
+					if line[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end >= len(line) {
+					return nil, fmt.Errorf("unterminated quoted value for key '%s'", key)
+				}
+				unquoted, err := strconv.Unquote(line[i : end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid quoted value for key '%s': %w", key, err)
+				}
+				value = unquoted
+				i = end + 1
+			} else {
+				start := i
+				for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+					i++
+				}
+				value = line[start:i]
+			}
+		}
+
+		rec.set(key, value)
+	}
+}
+
+// logfmtRecordWriter はレコードを logfmt で書き出します。
+// フィールドは入力の順に並べ、ルックアップで追加したフィールドを末尾に加えます。
+type logfmtRecordWriter struct {
+	w     io.Writer
+	extra []string
+}
+
+func (l *logfmtRecordWriter) Write(rec *inputRecord) error {
+	var buf bytes.Buffer
+	for i, key := range orderedKeys(rec, l.extra) {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key)
+		value := rec.fields[key]
+		if value == nil {
+			continue
+		}
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(value))
+	}
+	buf.WriteByte('\n')
+	_, err := l.w.Write(buf.Bytes())
+	return err
+}
+
+func (l *logfmtRecordWriter) Close() error {
+	return nil
+}
+
+// logfmtValue は値を logfmt の値として表します。
+// 空白や = 、引用符、制御文字を含む文字列と空文字列は引用符で囲み、文字列以外はJSONで表します。
+func logfmtValue(value interface{}) string {
+	s, ok := value.(string)
+	if !ok {
+		data, err := json.Marshal(value)
+		if err != nil {
+			s = fmt.Sprint(value)
+		} else {
+			s = string(data)
+		}
+	}
+	needsQuote := s == "" || strings.ContainsAny(s, " =\"\\") ||
+		slices.ContainsFunc([]rune(s), func(r rune) bool { return r < 0x20 || r == 0x7f })
+	if needsQuote {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLogfmt(t *testing.T) {
+	testCases := []struct {
+		name     string
+		line     string
+		keys     []string
+		fields   map[string]interface{}
+		hasError bool
+	}{
+		{
+			name:   "Plain and quoted values",
+			line:   `ts=2024-01-01T00:00:00Z user=alice msg="login ok" path="C:\\tmp\\\"x\""`,
+			keys:   []string{"ts", "user", "msg", "path"},
+			fields: map[string]interface{}{"ts": "2024-01-01T00:00:00Z", "user": "alice", "msg": "login ok", "path": `C:\tmp\"x"`},
+		},
+		{
+			name:   "Bare key and empty value",
+			line:   "  debug level= \tuser=bob ",
+			keys:   []string{"debug", "level", "user"},
+			fields: map[string]interface{}{"debug": nil, "level": "", "user": "bob"},
+		},
+		{
+			name:   "Duplicate key keeps the first position and the last value",
+			line:   "a=1 b=2 a=3",
+			keys:   []string{"a", "b"},
+			fields: map[string]interface{}{"a": "3", "b": "2"},
+		},
+		{name: "Unterminated quote", line: `msg="oops user=alice`, hasError: true},
+		{name: "Missing key", line: "user=alice =x", hasError: true},
+		{name: "Quote in key", line: `us"er=alice`, hasError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := parseLogfmt(tc.line)
+			if tc.hasError {
+				if err == nil {
+					t.Fatalf("Expected an error, but got %+v", rec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLogfmt failed: %v", err)
+			}
+			if !reflect.DeepEqual(rec.keys, tc.keys) || !reflect.DeepEqual(rec.fields, tc.fields) {
+				t.Errorf("Expected %v %v, but got %v %v", tc.keys, tc.fields, rec.keys, rec.fields)
+			}
+		})
+	}
+}
+
+func TestLogfmtRoundTrip(t *testing.T) {
+	line := `ts=1 msg="a b" empty="" debug eq="x=y" quote="say \"hi\"" nl="a\nb" user=alice`
+	rec, err := parseLogfmt(line)
+	if err != nil {
+		t.Fatalf("parseLogfmt failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := (&logfmtRecordWriter{w: &out}).Write(rec); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if out.String() != line+"\n" {
+		t.Errorf("Expected %q, but got %q", line+"\n", out.String())
+	}
+}
+
+func TestProcessInputLogfmt(t *testing.T) {
+	input := "ts=1 user=Alice ip=10.0.0.1\n" +
+		"\n" +
+		`msg="broken` + "\n" +
+		"user=nobody level=warn\n" +
+		`z=last user=bob msg="hello world"` + "\n"
+	processor := newTestProcessor(t, "user as name OUTPUT title, dept as department")
+
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader(input), "-", &out, ioFormats{input: "logfmt", output: "logfmt"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	// Field order is kept, the OUTPUT fields follow in OUTPUT order, and the broken line is skipped.
+	expected := `ts=1 user=Alice ip=10.0.0.1 title=Manager department="Sales, EMEA"` + "\n" +
+		"user=nobody level=warn\n" +
+		`z=last user=bob msg="hello world" title="" department=Engineering` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
+
+func TestProcessInputJSONToLogfmt(t *testing.T) {
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	processor.statusField = "_lookup"
+	input := `{"user": "bob", "count": 3, "tags": ["a", "b"]}` + "\n"
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader(input), "-", &out, ioFormats{output: "logfmt"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	// JSON has no field order, so the input fields are written in name order before the added ones;
+	// non-strings are written as JSON.
+	expected := `count=3 tags="[\"a\",\"b\"]" user=bob dept=Engineering _lookup="{\"matched\":true,\"match_count\":1,\"matched_pattern\":\"bob\"}"` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
+
+func TestLogfmtReaderRecordError(t *testing.T) {
+	reader := newLogfmtRecordReader(strings.NewReader(`a="x` + "\n"))
+	_, err := reader.Read()
+	var recErr *recordError
+	if !errors.As(err, &recErr) || recErr.format != "logfmt" || recErr.raw != `a="x` {
+		t.Errorf("Expected a logfmt recordError, but got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --- ルックアップ処理の抽象化 ---
+
+// Lookuper は入力値に対応するデータを検索する処理の共通インターフェースです。
+// 一致するデータがない場合は nil を返します。
+type Lookuper interface {
+	Lookup(value string) (map[string]string, error)
+}
+
+// multiLookuper は一致するすべての行を返せる Lookuper が実装します (INTO の [] で使用します)。
+type multiLookuper interface {
+	LookupAll(value string) ([]map[string]string, error)
+}
+
+// lookupAll は lookuper が multiLookuper であれば一致するすべての行を、そうでなければ最初に一致した行だけを返します。
+func lookupAll(lookuper Lookuper, value string) ([]map[string]string, error) {
+	if m, ok := lookuper.(multiLookuper); ok {
+		return m.LookupAll(value)
+	}
+	row, err := lookuper.Lookup(value)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	return []map[string]string{row}, nil
+}
+
+// tableLookuper はCSV/JSONから読み込んだテーブルに対してマッチングを行います。
+type tableLookuper struct {
+	data    LookupData
+	matcher *Matcher
+}
+
+// Lookup はテーブル内で最初に一致した行を返します。
+func (t *tableLookuper) Lookup(value string) (map[string]string, error) {
+	return findMatch(value, t.data, t.matcher), nil
+}
+
+// LookupAll はテーブル内で一致したすべての行をテーブルの順に返します。
+func (t *tableLookuper) LookupAll(value string) ([]map[string]string, error) {
+	return findAllMatches(value, t.data, t.matcher), nil
+}
+
+// Explain はテーブルを先頭から走査した過程を説明します。
+func (t *tableLookuper) Explain(value string) (map[string]string, *lookupExplanation, error) {
+	ex := (&lookupExplanation{Source: "table", NormalizedValue: normalizeLookupValue(value, t.matcher)}).withMatcher(t.matcher)
+	return findMatchExplained(value, t.data, t.matcher, ex), ex, nil
+}
+
+// DNSの問い合わせ結果のキャッシュの既定値です。
+const (
+	defaultDNSCacheSize = 10000
+	defaultDNSCacheTTL  = 5 * time.Minute
+)
+
+// dnsLookuper はDNSの正引き・逆引きによるルックアップを行います。
+// 同じ値の問い合わせを繰り返さないよう、結果 (見つからなかった場合も含む) をキャッシュします。
+// タイムアウトなど問い合わせ自体に失敗した場合はキャッシュせず、エラーを返します。
+type dnsLookuper struct {
+	serverAddr string
+	cache      *lookupCache
+}
+
+func newDNSLookuper(serverAddr string) *dnsLookuper {
+	return &dnsLookuper{serverAddr: serverAddr, cache: newLookupCache(defaultDNSCacheSize, defaultDNSCacheTTL)}
+}
+
+// Lookup はDNSの問い合わせ結果を文字列のマップとして返します。
+func (d *dnsLookuper) Lookup(value string) (map[string]string, error) {
+	if result, ok := d.cache.get(value); ok {
+		return result, nil
+	}
+	dnsRes, err := performDnsLookup(value, d.serverAddr)
+	if err != nil {
+		// 一時的な失敗の可能性があるため、キャッシュせずに次回も問い合わせます。
+		return nil, err
+	}
+	var result map[string]string
+	if dnsRes != nil {
+		result = make(map[string]string, len(dnsRes))
+		for k, v := range dnsRes {
+			result[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	d.cache.put(value, result)
+	return result, nil
+}
+
+// cacheStats はキャッシュのヒット数とミス数を返します。
+func (d *dnsLookuper) cacheStats() (hits, misses int64, ok bool) {
+	hits, misses = d.cache.stats()
+	return hits, misses, true
+}
+
+// Explain はDNSの問い合わせ結果を説明します。
+func (d *dnsLookuper) Explain(value string) (map[string]string, *lookupExplanation, error) {
+	ex := &lookupExplanation{Source: "dns", NormalizedValue: value}
+	if net.ParseIP(value) != nil {
+		ex.Method = "PTR"
+	} else {
+		ex.Method = "A"
+	}
+	hits, _ := d.cache.stats()
+	result, err := d.Lookup(value)
+	if after, _ := d.cache.stats(); after > hits {
+		ex.Index = "cache"
+	}
+	ex.finish(result != nil, "no DNS record found")
+	return result, ex, err
+}
+
+// newLookuper は設定ファイルの type に応じたルックアップ処理を生成します。
+// データソースを読み込み終えた時点で、stats の load 段階の計測を区切ります。
+func newLookuper(configPath string, config *Config, matcher *Matcher, stats *runStats) (Lookuper, error) {
+	switch config.Type {
+	case "", "file":
+		dataSourcePath, err := resolveConfiguredDataSource(configPath, config)
+		if err != nil {
+			return nil, err
+		}
+		if isMultiFileSource(dataSourcePath) {
+			if config.Snapshot != "" {
+				log.Println("Warning: Snapshots are not supported for directory or glob data sources; 'snapshot' is ignored.")
+			}
+			paths, err := expandDataSource(dataSourcePath, config.Merge)
+			if err != nil {
+				return nil, err
+			}
+			lookupData, err := loadMergedLookupData(paths, config.Merge)
+			if err != nil {
+				return nil, err
+			}
+			stats.lap(phaseLoad)
+			return &tableLookuper{data: lookupData, matcher: matcher}, nil
+		}
+		if config.Snapshot != "" {
+			// スナップショットの読み込みは、データソースの読み込みの代わりとして load 段階に含めます。
+			snapshotPath := resolveDataSourcePath(configPath, config.Snapshot)
+			lookuper, err := loadSnapshotLookuper(snapshotPath, dataSourcePath, matcher)
+			if err == nil {
+				stats.lap(phaseLoad)
+				return lookuper, nil
+			}
+			log.Printf("Warning: Not using snapshot, loading data source instead: %v", err)
+		}
+		lookupData, err := loadLookupData(dataSourcePath)
+		if err != nil {
+			return nil, err
+		}
+		stats.lap(phaseLoad)
+		return &tableLookuper{data: lookupData, matcher: matcher}, nil
+	case "kv":
+		dataSourcePath, err := resolveConfiguredDataSource(configPath, config)
+		if err != nil {
+			return nil, err
+		}
+		stats.lap(phaseLoad)
+		return newKVLookuper(dataSourcePath, matcher)
+	case "mmdb":
+		dataSourcePath, err := resolveConfiguredDataSource(configPath, config)
+		if err != nil {
+			return nil, err
+		}
+		stats.lap(phaseLoad)
+		return newMMDBLookuper(dataSourcePath)
+	case "http":
+		if config.HTTP == nil {
+			return nil, fmt.Errorf("data source type 'http' requires an 'http' section")
+		}
+		stats.lap(phaseLoad)
+		return newHTTPLookuper(config.HTTP)
+	default:
+		return nil, fmt.Errorf("unsupported data source type '%s'", config.Type)
+	}
+}
+
+// resolveConfiguredDataSource は data_source をローカルのパスに解決します。
+// URLの場合はダウンロードしたキャッシュファイルのパスを返します。
+func resolveConfiguredDataSource(configPath string, config *Config) (string, error) {
+	dataSourcePath := resolveDataSourcePath(configPath, config.DataSource)
+	if isRemoteURL(dataSourcePath) {
+		return fetchConfiguredRemote(configPath, config)
+	}
+	return dataSourcePath, nil
+}
+
+// fetchConfiguredRemote は設定の remote セクションに従ってURLのデータソースを取得します。
+func fetchConfiguredRemote(configPath string, config *Config) (string, error) {
+	var cacheDir string
+	if config.Remote != nil && config.Remote.CacheDir != "" {
+		cacheDir = resolveDataSourcePath(configPath, config.Remote.CacheDir)
+	} else {
+		var err error
+		cacheDir, err = defaultRemoteCacheDir()
+		if err != nil {
+			return "", err
+		}
+	}
+	return fetchRemoteDataSource(config.DataSource, cacheDir, config.Remote)
+}
+
+// loadLookupData は拡張子に応じてCSVまたはJSONのデータソースを読み込みます。
+func loadLookupData(path string) (LookupData, error) {
+	ext := filepath.Ext(path)
+	switch strings.ToLower(ext) {
+	case ".csv":
+		return loadLookupDataFromCSV(path)
+	case ".json", ".jsonl":
+		return loadLookupDataFromJSON(path)
+	default:
+		return nil, fmt.Errorf("unsupported data_source format '%s'", ext)
+	}
+}
+
+// scanLookupData は拡張子に応じてCSVまたはJSONのデータソースを1行ずつ fn に渡します。
+func scanLookupData(path string, fn func(row map[string]string) error) error {
+	return scanLookupDataLines(path, func(row map[string]string, _ int) error {
+		return fn(row)
+	})
+}
+
+// scanLookupDataLines は scanLookupData と同様ですが、各行のファイル内の行番号も fn に渡します。
+func scanLookupDataLines(path string, fn func(row map[string]string, line int) error) error {
+	ext := filepath.Ext(path)
+	switch strings.ToLower(ext) {
+	case ".csv":
+		return scanLookupDataFromCSVLines(path, fn)
+	case ".json", ".jsonl":
+		return scanLookupDataFromJSONLines(path, fn)
+	default:
+		return fmt.Errorf("unsupported data_source format '%s'", ext)
+	}
+}
@@ -2,35 +2,44 @@ package main
 
 import (
 	"bufio"
-	"bytes" // 入力形式の判定のために追加
 	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"text/template"
+	"time"
 )
 
 // --- データ構造定義 ---
 
 // Config は設定ファイル(config.json)の構造を表します。
 type Config struct {
-	DataSource string    `json:"data_source"`
-	Matchers   []Matcher `json:"matchers"`
+	Type       string              `json:"type,omitempty"`     // "file" (既定), "kv", "mmdb", "http"
+	DataSource string              `json:"data_source"`        // ファイルパスまたは http(s):// のURL
+	Snapshot   string              `json:"snapshot,omitempty"` // build-snapshot で生成したスナップショットのパス
+	Merge      *MergeConfig        `json:"merge,omitempty"`    // data_source がディレクトリやglobの場合の結合方法
+	Remote     *RemoteSourceConfig `json:"remote,omitempty"`
+	HTTP       *HTTPSourceConfig   `json:"http,omitempty"`
+	Matchers   []Matcher           `json:"matchers"`
 }
 
 // Matcher は個々のマッチング規則を定義します。
 type Matcher struct {
-	InputField     string `json:"input_field"`
-	LookupField    string `json:"lookup_field"`
-	Method         string `json:"method"` // "exact", "wildcard", "regex", "cidr"
-	CaseSensitive  bool   `json:"case_sensitive"`
+	InputField    string `json:"input_field"`
+	LookupField   string `json:"lookup_field"`
+	Method        string `json:"method"` // "exact", "wildcard", "regex", "cidr"
+	CaseSensitive bool   `json:"case_sensitive"`
 }
 
 // Mapping はコマンドライン引数 -m のパース結果を保持します。
@@ -38,6 +47,9 @@ type Mapping struct {
 	InputField  string
 	LookupField string
 	OutputMap   map[string]string // Key: original output field, Value: new field name
+	OutputNames []string          // OutputMap の値 (出力するフィールド名) を OUTPUT での指定順に並べたもの
+	Into        []string          // INTO で指定した、出力先のオブジェクトのパス (nil の場合はレコードの最上位)
+	IntoAll     bool              // INTO のパスが [] で終わる場合、一致したすべての行をオブジェクトの配列として書き込む
 }
 
 // LookupData はCSVやJSONから読み込んだデータの汎用的な表現です。
@@ -50,6 +62,26 @@ var (
 	isDnsLookup    = flag.Bool("dns", false, "Enable DNS lookup mode.")
 	dnsServerAddr  = flag.String("dns-server", "", "Custom DNS server address (e.g., '8.8.8.8:53'). Uses system default if not set.")
 	showVersion    = flag.Bool("version", false, "Print version and exit")
+	watchMode      = flag.Bool("watch", false, "Reload the config and data source in the background when they change.")
+	watchInterval  = flag.Duration("watch-interval", 5*time.Second, "Polling interval for --watch.")
+	explainMode    = flag.String("explain", "", "Explain the match decision for each record: 'stderr' (JSON lines) or 'field' (adds _lookup_debug).")
+	statsFormat    = flag.String("stats", "", "Print run statistics to stderr when the input ends: 'text' or 'json'.")
+	whereFilter    = flag.String("where", "", "Output only 'matched' or only 'unmatched' records.")
+	filteredPath   = flag.String("filtered-output", "", "Write the records removed by --where to this file as JSON Lines.")
+	inputFormat    = flag.String("input-format", "json", "Format of the input: 'json' (JSON array or JSON Lines), 'csv' (with a header row), 'logfmt' (key=value lines) or 'syslog' (RFC 5424/3164, with CEF or LEEF messages).")
+	outputFormat   = flag.String("output-format", "json", "Format of the output: 'json', 'preserve' (the input JSON with only the added fields changed), 'csv' (the input columns followed by the OUTPUT fields), 'logfmt' or 'cef'.")
+	statusField    = flag.String("status-field", "", "Add an object with the match status (matched, match_count, matched_pattern, source) to each record under this field name (e.g. '_lookup').")
+	annotate       = flag.Bool("annotate", false, "Add the input file name (_source_file) and line number (_line_number) to each record.")
+	outputDir      = flag.String("output-dir", "", "Write the output for each input file to a file with the same name in this directory instead of stdout.")
+	parallelInputs = flag.Int("parallel", 1, "Number of input files to process in parallel.")
+	followMode     = flag.Bool("f", false, "Follow the input files like 'tail -F': keep reading appended lines and reopen them when they are rotated or truncated.")
+	stateFile      = flag.String("follow-state", "", "File to save the position in each followed input, so a restarted -f resumes where it stopped.")
+	followInterval = flag.Duration("follow-interval", time.Second, "Polling interval for new lines and rotation with -f.")
+	flushMode      = flag.String("flush", "", "When to write buffered output: 'every-record', 'interval', or 'size' (default: every-record with -f, interval otherwise).")
+	flushInterval  = flag.Duration("flush-interval", time.Second, "How often to write buffered output with --flush interval.")
+	flushSize      = flag.Int("flush-size", 64*1024, "Write buffered output once it reaches this many bytes.")
+	onError        = flag.String("on-error", "skip", "What to do with records that cannot be parsed or looked up (including DNS failures): 'skip', 'fail', 'passthrough', or 'dead-letter=<file>' to append them with the error to a JSON Lines file.")
+	templateText   = flag.String("template", "", "Render each enriched record with this Go text/template instead of writing JSON (e.g. '{{.user}}: {{.dept | default \"n/a\"}}'), or '@file' to read the template from a file.")
 )
 
 // version はビルド時にldflagsで注入されます。
@@ -62,6 +94,18 @@ func main() {
 		handleGenerateConfig()
 		return // generate-configが実行されたらここで終了
 	}
+	if len(os.Args) > 1 && os.Args[1] == "build-index" {
+		handleBuildIndex()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "build-snapshot" {
+		handleBuildSnapshot()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		handleValidate()
+		return
+	}
 
 	// カスタムのヘルプメッセージを設定
 	flag.Usage = func() {
@@ -69,13 +113,18 @@ func main() {
 
 Usage:
   lookup-go -c <config.json> -m "<mapping_rule>" < input.jsonl
+  lookup-go -c <config.json> -m "<mapping_rule>" [--output-dir <dir>] <file|glob|-> ...
   lookup-go --dns -m "<mapping_rule>" < input.jsonl
-  lookup-go generate-config -file <data_source.csv/json> > config.json
+  lookup-go generate-config -file <data_source.csv/json> [-format json|yaml|toml] [-sample N] [-stats] > config.json
+  lookup-go build-index -c <config.json> -lookup-field <field> -o <index.db>
+  lookup-go build-snapshot -c <config.json> [-o <table.snap>]
+  lookup-go validate -c <config.json>
   lookup-go --version
 
 Description:
-  This tool reads JSON or JSONL data from stdin, looks up values based on a specified field,
-  and appends information from an external data source (CSV or JSON) or DNS to the output.
+  This tool reads JSON or JSONL data from stdin (or the given files), looks up values based on a specified field,
+  and appends information from an external data source (CSV, JSON, MaxMind DB, key-value index,
+  or REST API) or DNS to the output.
 
 Subcommands:
   generate-config
@@ -83,6 +132,39 @@ Subcommands:
     Options:
       -file string
             Path to the data source file (CSV or JSON). (Required)
+      -format string
+            Output format of the configuration: json, yaml, or toml. (Default: json)
+      -sample int
+            Number of rows to analyze for suggesting match methods (0 for all). (Default: 10000)
+      -stats
+            Print column statistics and the suggested match methods to stderr.
+
+  build-index
+    Converts the data source of a config into an on-disk key-value index for fast exact lookups.
+    Options:
+      -c string
+            Path to the lookup configuration file of the source data. (Required)
+      -lookup-field string
+            The lookup_field of an exact matcher in the config to use as the key. (Required)
+      -o string
+            Path of the index file to create. (Required)
+
+  build-snapshot
+    Compiles the data source and all matchers of a config into a memory-mapped snapshot file.
+    Options:
+      -c string
+            Path to the lookup configuration file. (Required)
+      -o string
+            Path of the snapshot file to create. Defaults to the 'snapshot' setting of the config.
+
+  validate
+    Checks a config against the published JSON Schema and its data source, and reports all problems
+    with file names and line numbers (unknown fields, missing lookup fields, invalid patterns, etc.).
+    Options:
+      -c string
+            Path to the lookup configuration file to validate. (Required)
+      -schema
+            Print the JSON Schema of the configuration file and exit.
 
 Options:
 `)
@@ -108,7 +190,11 @@ Examples:
   #    Generate a config template from 'users.csv'.
   $ lookup-go generate-config -file users.csv > lookup_config.json
 
-  # 3. DNS Lookup
+  # 3. Multiple Files
+  #    Enrich every JSONL file in 'logs/', 4 at a time, writing the results to 'enriched/'.
+  $ lookup-go -c lookup_config.json -m "user_id as id OUTPUT user_name" --parallel 4 --output-dir enriched 'logs/*.jsonl'
+
+  # 4. DNS Lookup
   #    Perform a DNS lookup for the IP address in the 'client_ip' field.
   $ echo '{"client_ip":"8.8.8.8"}' | lookup-go --dns -m "client_ip as ip OUTPUT hostname"
 
@@ -132,150 +218,592 @@ Examples:
 	if *isDnsLookup && *configFilePath != "" {
 		log.Println("Warning: -c flag is ignored when --dns is specified.")
 	}
+	if *explainMode != "" && *explainMode != "stderr" && *explainMode != "field" {
+		log.Fatalf("Error: invalid --explain value '%s' (expected 'stderr' or 'field').", *explainMode)
+	}
+	if *statsFormat != "" && *statsFormat != "text" && *statsFormat != "json" {
+		log.Fatalf("Error: invalid --stats value '%s' (expected 'text' or 'json').", *statsFormat)
+	}
+	if *whereFilter != "" && *whereFilter != "matched" && *whereFilter != "unmatched" {
+		log.Fatalf("Error: invalid --where value '%s' (expected 'matched' or 'unmatched').", *whereFilter)
+	}
+	if *filteredPath != "" && *whereFilter == "" {
+		log.Println("Warning: --filtered-output is ignored without --where.")
+	}
+	if !slices.Contains(inputFormats, *inputFormat) {
+		log.Fatalf("Error: invalid --input-format value '%s' (expected one of %s).", *inputFormat, strings.Join(inputFormats, ", "))
+	}
+	if !slices.Contains(outputFormats, *outputFormat) {
+		log.Fatalf("Error: invalid --output-format value '%s' (expected one of %s).", *outputFormat, strings.Join(outputFormats, ", "))
+	}
+	var outputTemplate *template.Template
+	if *templateText != "" {
+		if *outputFormat != "json" {
+			log.Fatal("Error: --template cannot be combined with --output-format.")
+		}
+		tmpl, err := parseOutputTemplate(*templateText)
+		if err != nil {
+			log.Fatalf("Error: invalid --template: %v", err)
+		}
+		outputTemplate = tmpl
+	}
+	if *outputFormat == "preserve" && *inputFormat != "json" {
+		log.Fatal("Error: --output-format preserve requires JSON input.")
+	}
+	if *parallelInputs < 1 {
+		log.Fatalf("Error: invalid --parallel value '%d' (expected 1 or more).", *parallelInputs)
+	}
+	inputPaths, err := expandInputArgs(flag.Args())
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if *followMode && (len(flag.Args()) == 0 || slices.Contains(inputPaths, "-")) {
+		log.Fatal("Error: -f requires input files and cannot follow standard input.")
+	}
+	if *followMode && *inputFormat == "csv" {
+		log.Fatal("Error: -f cannot be used with --input-format csv.")
+	}
+	if *stateFile != "" && !*followMode {
+		log.Println("Warning: --follow-state is ignored without -f.")
+	}
+	if *flushMode == "" {
+		*flushMode = "interval"
+		if *followMode {
+			*flushMode = "every-record"
+		}
+	}
+	if !slices.Contains(flushModes, *flushMode) {
+		log.Fatalf("Error: invalid --flush value '%s' (expected one of %s).", *flushMode, strings.Join(flushModes, ", "))
+	}
+	if *flushInterval <= 0 || *flushSize < 1 {
+		log.Fatal("Error: --flush-interval and --flush-size must be positive.")
+	}
+	errPolicy, err := parseErrorPolicy(*onError)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer errPolicy.Close()
+	var stats *runStats
+	if *statsFormat != "" {
+		stats = newRunStats(*mappingStr)
+	}
 
 	mapping, err := parseMapping(*mappingStr)
 	if err != nil {
 		log.Fatalf("Error parsing mapping rule: %v", err)
 	}
+	if *outputFormat == "csv" && len(mapping.OutputNames) == 0 && mapping.Into == nil {
+		log.Fatal("Error: --output-format csv requires an OUTPUT or INTO clause in the mapping (-m) to define the added columns.")
+	}
 
-	var lookupData LookupData
-	var matcher *Matcher
-
-	if !*isDnsLookup {
-		config, err := loadConfig(*configFilePath)
-		if err != nil {
-			log.Fatalf("Error loading config file: %v", err)
-		}
+	var lookuper Lookuper
+	sourceName := "dns" // 一致状況の source に記録するデータソース名
 
-		for i := range config.Matchers {
-			m := &config.Matchers[i]
-			if m.InputField == mapping.InputField && m.LookupField == mapping.LookupField {
-				matcher = m
-				break
+	if *isDnsLookup {
+		lookuper = newDNSLookuper(*dnsServerAddr)
+	} else {
+		if *watchMode {
+			reloadable, err := newReloadableLookuper(*configFilePath, mapping, stats)
+			if err != nil {
+				log.Fatalf("Error: %v", err)
 			}
+			go reloadable.watch(*watchInterval, nil)
+			lookuper = reloadable
+		} else {
+			var config *Config
+			lookuper, config, err = buildLookuper(*configFilePath, mapping, stats)
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			sourceName = dataSourceName(config)
 		}
-		if matcher == nil {
-			log.Fatalf("Error: No matcher found in config for input_field='%s' and lookup_field='%s'", mapping.InputField, mapping.LookupField)
-		}
+	}
+	stats.lap(phaseIndex)
+	if *isDnsLookup && *watchMode {
+		log.Println("Warning: --watch flag is ignored when --dns is specified.")
+	}
 
-		dataSourcePath := resolveDataSourcePath(*configFilePath, config.DataSource)
-		ext := filepath.Ext(dataSourcePath)
-		switch strings.ToLower(ext) {
-		case ".csv":
-			lookupData, err = loadLookupDataFromCSV(dataSourcePath)
-		case ".json", ".jsonl":
-			lookupData, err = loadLookupDataFromJSON(dataSourcePath)
-		default:
-			err = fmt.Errorf("unsupported data_source format '%s'", ext)
+	processor := &recordProcessor{mapping: mapping, lookuper: lookuper, explain: *explainMode, explainOutput: os.Stderr, stats: stats, where: *whereFilter, annotate: *annotate, onError: errPolicy}
+	if *statusField != "" {
+		processor.statusField = *statusField
+		processor.sourceName = sourceName
+	}
+	if *filteredPath != "" && *whereFilter != "" {
+		file, err := os.OpenFile(*filteredPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			log.Fatalf("Error: could not create filtered output file: %v", err)
 		}
+		defer file.Close()
+		processor.filteredOutput = file
+	}
+	opts := inputOptions{
+		formats:   ioFormats{input: *inputFormat, output: *outputFormat, template: outputTemplate},
+		outputDir: *outputDir,
+		parallel:  *parallelInputs,
+		flush:     &flushPolicy{mode: *flushMode, interval: *flushInterval, size: *flushSize},
+	}
+	var stop chan struct{}
+	if *followMode {
+		stop = make(chan struct{})
+		follow, err := newFollower(*followInterval, *stateFile, stop)
 		if err != nil {
-			log.Fatalf("Error loading data source: %v", err)
+			log.Fatalf("Error: %v", err)
 		}
+		follow.flush = opts.flush.flushAll
+		opts.follow = follow
+	}
+	handleSignals(stop, opts.flush)
+	if err := processInputs(inputPaths, os.Stdout, opts, processor); err != nil {
+		log.Fatalf("Error: %v", err)
 	}
 
-	processInput(mapping, lookupData, matcher)
+	dropped := errPolicy.droppedCount()
+	if dropped > 0 {
+		log.Printf("Warning: %d record(s) could not be processed and were left out of the output.", dropped)
+	}
+	if stats != nil {
+		stats.lap(phaseProcess)
+		stats.collectCache(lookuper)
+		if err := stats.write(os.Stderr, *statsFormat); err != nil {
+			log.Printf("Warning: Could not write stats: %v", err)
+		}
+	}
+	if dropped > 0 {
+		errPolicy.Close()
+		os.Exit(exitCodeDropped)
+	}
 }
 
-// processInput は標準入力の形式を自動検出し、処理を振り分けます。
-func processInput(mapping *Mapping, lookupData LookupData, matcher *Matcher) {
-	inputBytes, err := io.ReadAll(os.Stdin)
+// buildLookuper は設定ファイルを読み込み、マッピングに対応する matcher のルックアップ処理を生成します。
+// 読み込んだ設定も返すため、呼び出し側は設定ファイルを読み直す必要はありません。
+// stats が nil でなければ、データソースの読み込みまでを load 段階として計測します。
+func buildLookuper(configPath string, mapping *Mapping, stats *runStats) (Lookuper, *Config, error) {
+	config, err := loadConfig(configPath)
 	if err != nil {
-		log.Fatalf("Error reading from stdin: %v", err)
+		return nil, nil, fmt.Errorf("could not load config file: %w", err)
 	}
 
-	trimmedInput := bytes.TrimSpace(inputBytes)
-	if len(trimmedInput) == 0 {
-		return
+	var matcher *Matcher
+	for i := range config.Matchers {
+		m := &config.Matchers[i]
+		if m.InputField == mapping.InputField && m.LookupField == mapping.LookupField {
+			matcher = m
+			break
+		}
+	}
+	if matcher == nil {
+		return nil, nil, fmt.Errorf("no matcher found in config for input_field='%s' and lookup_field='%s'", mapping.InputField, mapping.LookupField)
 	}
 
-	// JSON配列形式の場合
-	if trimmedInput[0] == '[' {
-		var dataArray []map[string]interface{}
-		if err := json.Unmarshal(trimmedInput, &dataArray); err != nil {
-			log.Fatalf("Error parsing JSON array: %v", err)
-		}
+	lookuper, err := newLookuper(configPath, config, matcher, stats)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load data source: %w", err)
+	}
+	return lookuper, config, nil
+}
 
-		var resultsArray []map[string]interface{}
-		for _, data := range dataArray {
-			processedData := processObject(data, mapping, lookupData, matcher)
-			resultsArray = append(resultsArray, processedData)
-		}
+// processInput は入力をレコードごとに処理し、output に書き出します。
+// JSONの入力では配列とJSONLを自動検出し、JSONLやCSVは1行ずつ読み込んで逐次出力するため、長時間動作するパイプの途中でも使用できます。
+// source は入力の名前 (ファイルのパス、標準入力では "-") で、--annotate で _source_file に記録します。
+func processInput(input io.Reader, source string, output io.Writer, formats ioFormats, processor *recordProcessor) error {
+	reader, err := newRecordReader(formats.input, input)
+	if err != nil {
+		return err
+	}
+	var writer recordWriter
+	if formats.template != nil {
+		writer = &templateWriter{w: output, tmpl: formats.template}
+	} else if writer, err = newRecordWriter(formats.output, output, reader, processor.outputColumns()); err != nil {
+		return err
+	}
 
-		// 結果を整形してJSON配列として出力
-		output, err := json.MarshalIndent(resultsArray, "", "  ")
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *recordError
+		if errors.As(err, &parseErr) {
+			processor.stats.read(false)
+			failure := &recordFailure{Stage: stageParse, Error: parseErr.Error(), Source: source, Line: parseErr.line, Raw: parseErr.raw}
+			pass, err := processor.handleFailure(failure)
+			if err != nil {
+				return err
+			}
+			if pass {
+				if err := writeRawRecord(writer, output, parseErr.raw); err != nil {
+					return fmt.Errorf("could not write output: %w", err)
+				}
+				if err := recordDone(output); err != nil {
+					return fmt.Errorf("could not write output: %w", err)
+				}
+			}
+			continue
+		}
 		if err != nil {
-			log.Fatalf("Error marshalling result array to JSON: %v", err)
+			return err
+		}
+		processor.stats.read(true)
+		if processor.annotate {
+			rec.fields[sourceFileField] = source
+			rec.fields[lineNumberField] = rec.line
 		}
-		fmt.Println(string(output))
 
-	// JSONL (または単一のJSON) 形式の場合
-	} else {
-		scanner := bufio.NewScanner(bytes.NewReader(inputBytes))
-		for scanner.Scan() {
-			line := scanner.Bytes()
-			if len(bytes.TrimSpace(line)) == 0 {
-				continue
+		processedData, result, err := processor.processObject(rec.fields)
+		if err != nil {
+			failure := &recordFailure{Stage: processor.failureStage(), Error: err.Error(), Source: source, Line: rec.line, Record: processedData}
+			pass, err := processor.handleFailure(failure)
+			if err != nil {
+				return err
 			}
-
-			var data map[string]interface{}
-			if err := json.Unmarshal(line, &data); err != nil {
-				log.Printf("Warning: Could not parse line as JSON, skipping: %s", string(line))
+			if !pass {
 				continue
 			}
+		}
+		if processor.keep(processedData, result) {
+			err := writer.Write(rec)
+			var renderErr *renderError
+			if errors.As(err, &renderErr) {
+				failure := &recordFailure{Stage: stageRender, Error: renderErr.Error(), Source: source, Line: rec.line, Record: processedData}
+				pass, failErr := processor.handleFailure(failure)
+				if failErr != nil {
+					return failErr
+				}
+				if !pass {
+					continue
+				}
+				// テンプレートを適用できないレコードは、JSONのまま書き出します。
+				data, _ := json.Marshal(processedData)
+				err = writeRawRecord(writer, output, string(data))
+			}
+			if err != nil {
+				return fmt.Errorf("could not write output: %w", err)
+			}
+			if err := recordDone(output); err != nil {
+				return fmt.Errorf("could not write output: %w", err)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("could not write output: %w", err)
+	}
+	if err := recordDone(output); err != nil {
+		return fmt.Errorf("could not write output: %w", err)
+	}
+	return nil
+}
+
+// recordDone は出力先が recordFlusher であれば、レコードを書き出したことを通知します。
+func recordDone(output io.Writer) error {
+	if flusher, ok := output.(recordFlusher); ok {
+		return flusher.recordDone()
+	}
+	return nil
+}
 
-			processedData := processObject(data, mapping, lookupData, matcher)
-			printJSON(processedData)
+// peekFirstNonSpace は先頭の空白を読み飛ばし、最初の空白以外のバイトを読み取らずに返します。
+func peekFirstNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
 		}
-		if err := scanner.Err(); err != nil {
-			log.Fatalf("Error scanning input: %v", err)
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.ReadByte()
+		default:
+			return b[0], nil
 		}
 	}
 }
 
-// processObject は単一のJSONオブジェクトに対してルックアップ処理を行います。
-func processObject(data map[string]interface{}, mapping *Mapping, lookupData LookupData, matcher *Matcher) map[string]interface{} {
+// recordProcessor は入力のレコードごとにルックアップを行い、結果をレコードに追加します。
+type recordProcessor struct {
+	mapping  *Mapping
+	lookuper Lookuper
+
+	explain       string    // "" (無効), "stderr", "field"
+	explainOutput io.Writer // explain が "stderr" の場合の出力先
+	stats         *runStats // --stats が無効な場合は nil
+
+	where          string    // "" (すべて出力), "matched", "unmatched"
+	filteredOutput io.Writer // where で除外したレコードの出力先 (nil の場合は破棄)
+
+	statusField string // 一致状況を書き込むフィールド名 ("" の場合は書き込まない)
+	sourceName  string // 一致状況の source に記録するデータソース名
+
+	annotate bool // 入力のファイル名と行番号を _source_file と _line_number に記録する
+
+	onError *errorPolicy // 失敗したレコードの扱い (nil の場合は読み飛ばす)
+}
+
+// processObject は単一のJSONオブジェクトに対してルックアップ処理を行い、
+// ルックアップ結果の種類 (explainMatched など) とともに返します。
+// ルックアップに失敗した場合は、結果を追加していないレコードとともにそのエラーを返します。
+func (p *recordProcessor) processObject(data map[string]interface{}) (map[string]interface{}, string, error) {
+	var ex *lookupExplanation
+	if p.explain != "" {
+		ex = &lookupExplanation{InputField: p.mapping.InputField}
+	}
+	result, rows, err := p.lookupObject(data, ex)
+	p.stats.record(result)
+	if p.statusField != "" {
+		data[p.statusField] = newMatchStatus(rows, p.mapping.LookupField, p.statusSource())
+	}
+	if ex == nil {
+		return data, result, err
+	}
+	if p.explain == "field" {
+		data[explainFieldName] = ex
+	} else if err := writeExplanation(p.explainOutput, ex); err != nil {
+		log.Printf("Warning: Could not write explanation: %v", err)
+	}
+	return data, result, err
+}
+
+// statusSource は一致状況の source に記録するデータソース名です。
+// --watch では、再読み込みした設定のデータソース名を使います。
+func (p *recordProcessor) statusSource() string {
+	if reloadable, ok := p.lookuper.(*reloadableLookuper); ok {
+		return reloadable.sourceName()
+	}
+	return p.sourceName
+}
+
+// failureStage はルックアップに失敗したレコードの段階 (DNSの問い合わせ、またはデータソースのルックアップ) です。
+func (p *recordProcessor) failureStage() string {
+	if _, ok := p.lookuper.(*dnsLookuper); ok {
+		return stageDNS
+	}
+	return stageMatch
+}
+
+// handleFailure は失敗したレコードを --on-error に従って扱い、出力するかどうかを返します。
+func (p *recordProcessor) handleFailure(f *recordFailure) (bool, error) {
+	pass, err := p.onError.handle(f)
+	if err == nil && !pass {
+		p.stats.drop()
+	}
+	return pass, err
+}
+
+// outputColumns はルックアップで追加するフィールドの名前です。CSVの出力ではヘッダーの末尾に加えます。
+// INTO を指定した場合は、出力先のパスの最上位のフィールドです。--annotate のフィールドはその前に置きます。
+func (p *recordProcessor) outputColumns() []string {
+	var columns []string
+	if p.annotate {
+		columns = append(columns, sourceFileField, lineNumberField)
+	}
+	if p.mapping.Into != nil {
+		columns = append(columns, p.mapping.Into[0])
+	} else {
+		columns = append(columns, p.mapping.OutputNames...)
+	}
+	if p.statusField != "" {
+		columns = append(columns, p.statusField)
+	}
+	if p.explain == "field" {
+		columns = append(columns, explainFieldName)
+	}
+	return columns
+}
+
+// keep は --where の条件で、結果が result のレコードを出力するかどうかを判定します。
+// 除外したレコードは filteredOutput に書き出します。
+// "unmatched" には、一致しなかったレコードのほか、入力フィールドがないレコードやエラーになったレコードも含まれます。
+func (p *recordProcessor) keep(data map[string]interface{}, result string) bool {
+	matched := result == explainMatched
+	if p.where == "" || (p.where == "matched") == matched {
+		return true
+	}
+	p.stats.filter()
+	if p.filteredOutput != nil {
+		writeJSONLine(p.filteredOutput, data)
+	}
+	return false
+}
+
+// lookupObject はルックアップの結果をレコードに追加し、結果の種類 (explainMatched など) と一致した行を返します。
+// 一致した行は、INTO の [] を指定した場合は一致したすべての行、それ以外は最初に一致した行だけです。
+// ex が nil でなければ判定の過程を記録します。
+func (p *recordProcessor) lookupObject(data map[string]interface{}, ex *lookupExplanation) (string, []map[string]string, error) {
+	mapping := p.mapping
 	inputValue, ok := data[mapping.InputField]
 	if !ok {
-		return data
+		if ex != nil {
+			ex.Result = explainSkipped
+			ex.Reason = fmt.Sprintf("input field '%s' not found in record", mapping.InputField)
+		}
+		return explainSkipped, nil, nil
 	}
 	inputValueStr, ok := inputValue.(string)
 	if !ok {
-		return data
+		if ex != nil {
+			ex.InputValue = inputValue
+			ex.Result = explainSkipped
+			ex.Reason = fmt.Sprintf("input field '%s' is not a string (got %s)", mapping.InputField, jsonTypeName(inputValue))
+		}
+		return explainSkipped, nil, nil
 	}
 
-	var lookupResult map[string]string
-	if *isDnsLookup {
-		dnsRes := performDnsLookup(inputValueStr, *dnsServerAddr)
-		if dnsRes != nil {
-			lookupResult = make(map[string]string)
-			for k, v := range dnsRes {
-				lookupResult[k] = fmt.Sprintf("%v", v)
+	var rows []map[string]string
+	var err error
+	switch {
+	case ex != nil:
+		var row map[string]string
+		var detail *lookupExplanation
+		row, detail, err = explainLookup(p.lookuper, inputValueStr)
+		*ex = *detail
+		ex.InputField = mapping.InputField
+		ex.InputValue = inputValueStr
+		if err == nil && row != nil {
+			rows = []map[string]string{row}
+			if mapping.IntoAll {
+				rows, err = lookupAll(p.lookuper, inputValueStr)
 			}
 		}
-	} else {
-		lookupResult = findMatch(inputValueStr, lookupData, matcher)
+		if err != nil {
+			ex.Result = explainError
+			ex.Reason = err.Error()
+		}
+	case mapping.IntoAll:
+		rows, err = lookupAll(p.lookuper, inputValueStr)
+	default:
+		var row map[string]string
+		if row, err = p.lookuper.Lookup(inputValueStr); row != nil {
+			rows = []map[string]string{row}
+		}
+	}
+	if err != nil {
+		return explainError, nil, fmt.Errorf("lookup failed for value '%s': %w", inputValueStr, err)
 	}
 
-	if lookupResult != nil {
-		for originalKey, value := range lookupResult {
-			newKey, exists := mapping.OutputMap[originalKey]
-			if !exists && len(mapping.OutputMap) == 0 {
-				newKey = originalKey
-				exists = true
-			}
-			if exists {
-				data[newKey] = value
+	if len(rows) == 0 {
+		return explainNoMatch, nil, nil
+	}
+	if err := mapping.writeOutputs(data, rows); err != nil {
+		log.Printf("Warning: Could not write lookup results for value '%s': %v", inputValueStr, err)
+	}
+	return explainMatched, rows, nil
+}
+
+// outputFields は一致した行から OUTPUT で指定したフィールドを取り出し、出力する名前を付けます。
+// OUTPUT を省略した場合は行のすべてのフィールドをそのままの名前で返します。
+func (m *Mapping) outputFields(row map[string]string) map[string]interface{} {
+	fields := make(map[string]interface{}, len(row))
+	for originalKey, value := range row {
+		newKey, exists := m.OutputMap[originalKey]
+		if !exists && len(m.OutputMap) == 0 {
+			newKey = originalKey
+			exists = true
+		}
+		if exists {
+			fields[newKey] = value
+		}
+	}
+	return fields
+}
+
+// writeOutputs は一致した行の出力フィールドをレコードに書き込みます。
+// INTO を指定した場合は、そのパスのオブジェクト (なければ作成します) に、[] ではすべての行をオブジェクトの配列として書き込みます。
+func (m *Mapping) writeOutputs(data map[string]interface{}, rows []map[string]string) error {
+	if m.Into == nil {
+		maps.Copy(data, m.outputFields(rows[0]))
+		return nil
+	}
+	if m.IntoAll {
+		parent, err := nestedObject(data, m.Into[:len(m.Into)-1])
+		if err != nil {
+			return err
+		}
+		objects := make([]interface{}, len(rows))
+		for i, row := range rows {
+			objects[i] = m.outputFields(row)
+		}
+		parent[m.Into[len(m.Into)-1]] = objects
+		return nil
+	}
+	target, err := nestedObject(data, m.Into)
+	if err != nil {
+		return err
+	}
+	maps.Copy(target, m.outputFields(rows[0]))
+	return nil
+}
+
+// nestedObject は data の path にあるオブジェクトを返します。途中のオブジェクトがなければ作成します。
+// 途中にオブジェクト以外の値がある場合は、上書きせずにエラーを返します。
+func nestedObject(data map[string]interface{}, path []string) (map[string]interface{}, error) {
+	current := data
+	for i, key := range path {
+		switch value := current[key].(type) {
+		case map[string]interface{}:
+			current = value
+		case nil:
+			if _, exists := current[key]; exists {
+				return nil, fmt.Errorf("'%s' is not an object", strings.Join(path[:i+1], "."))
 			}
+			next := make(map[string]interface{})
+			current[key] = next
+			current = next
+		default:
+			return nil, fmt.Errorf("'%s' is not an object", strings.Join(path[:i+1], "."))
 		}
 	}
-	return data
+	return current, nil
 }
 
 // findMatch は設定に基づき、データソース内で一致するエントリを探します。
 func findMatch(value string, data LookupData, matcher *Matcher) map[string]string {
-	for _, row := range data {
+	return findMatchExplained(value, data, matcher, nil)
+}
+
+// findMatchExplained は findMatch と同じ検索を行い、ex が nil でなければ判定の過程を記録します。
+func findMatchExplained(value string, data LookupData, matcher *Matcher, ex *lookupExplanation) map[string]string {
+	if ex != nil && matcher.Method == "cidr" && net.ParseIP(value) == nil {
+		ex.finish(false, "input value is not an IP address")
+		return nil
+	}
+	var found map[string]string
+	missing, invalid, err := scanMatches(value, data, matcher, ex, func(i int, row map[string]string) bool {
+		found = row
+		if ex != nil {
+			ex.MatchedRow = i + 1
+			ex.MatchedValue = row[matcher.LookupField]
+			ex.finish(true, "")
+		}
+		return false
+	})
+	if ex != nil && found == nil {
+		if err != nil {
+			ex.finish(false, err.Error())
+		} else {
+			ex.finish(false, noMatchReason(ex.RowsConsidered, missing, invalid, matcher.LookupField))
+		}
+	}
+	return found
+}
+
+// findAllMatches は findMatch と同じ条件で、一致するすべての行をデータソースの順に返します。
+func findAllMatches(value string, data LookupData, matcher *Matcher) []map[string]string {
+	var rows []map[string]string
+	scanMatches(value, data, matcher, nil, func(_ int, row map[string]string) bool {
+		rows = append(rows, row)
+		return true
+	})
+	return rows
+}
+
+// scanMatches はデータソースを先頭から走査し、一致した行ごとに fn を呼び出します。fn が false を返すと走査を終えます。
+// lookup_field のない行と不正なパターンの行の数を返します。ex が nil でなければ走査した行数を記録します。
+func scanMatches(value string, data LookupData, matcher *Matcher, ex *lookupExplanation, fn func(i int, row map[string]string) bool) (missing, invalid int, err error) {
+	for i, row := range data {
+		if ex != nil {
+			ex.RowsConsidered++
+		}
 		lookupValue, ok := row[matcher.LookupField]
 		if !ok {
+			missing++
 			continue
 		}
 
@@ -301,33 +829,36 @@ func findMatch(value string, data LookupData, matcher *Matcher) map[string]strin
 			ip := net.ParseIP(compareValue)
 			if ip != nil {
 				_, cidrNet, parseErr := net.ParseCIDR(compareLookupValue)
-				if parseErr == nil && cidrNet.Contains(ip) {
+				if parseErr != nil {
+					invalid++
+				} else if cidrNet.Contains(ip) {
 					matched = true
 				}
 			}
 		default:
 			log.Printf("Warning: Unknown match method '%s'", matcher.Method)
-			return nil
+			return missing, invalid, fmt.Errorf("unknown match method '%s'", matcher.Method)
 		}
 
 		if err != nil {
 			log.Printf("Warning: Error during match (method: %s, pattern: %s): %v", matcher.Method, lookupValue, err)
+			invalid++
 			continue
 		}
 
-		if matched {
-			return row
+		if matched && !fn(i, row) {
+			break
 		}
 	}
-	return nil
+	return missing, invalid, nil
 }
 
 // performDnsLookup はDNSの正引き・逆引きを行います。
-func performDnsLookup(value string, serverAddr string) map[string]interface{} {
-	result := make(map[string]interface{})
-
+// レコードが見つからない場合は nil を、問い合わせ自体に失敗した場合 (タイムアウトなど) はエラーを返します。
+func performDnsLookup(value string, serverAddr string) (map[string]interface{}, error) {
+	resolver := net.DefaultResolver
 	if serverAddr != "" {
-		resolver := &net.Resolver{
+		resolver = &net.Resolver{
 			PreferGo: true,
 			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
 				d := net.Dialer{}
@@ -338,60 +869,62 @@ func performDnsLookup(value string, serverAddr string) map[string]interface{} {
 				return d.DialContext(ctx, "udp", addr)
 			},
 		}
-		ctx := context.Background()
-
-		if ip := net.ParseIP(value); ip != nil {
-			names, err := resolver.LookupAddr(ctx, value)
-			if err == nil && len(names) > 0 {
-				result["hostname"] = strings.TrimSuffix(names[0], ".")
-				return result
-			}
-		} else {
-			addrs, err := resolver.LookupHost(ctx, value)
-			if err == nil && len(addrs) > 0 {
-				result["ip"] = addrs[0]
-				return result
-			}
-		}
-		return nil
 	}
+	ctx := context.Background()
 
 	if ip := net.ParseIP(value); ip != nil {
-		names, err := net.LookupAddr(value)
+		names, err := resolver.LookupAddr(ctx, value)
 		if err == nil && len(names) > 0 {
-			result["hostname"] = strings.TrimSuffix(names[0], ".")
-			return result
-		}
-	} else {
-		addrs, err := net.LookupHost(value)
-		if err == nil && len(addrs) > 0 {
-			result["ip"] = addrs[0]
-			return result
+			return map[string]interface{}{"hostname": strings.TrimSuffix(names[0], ".")}, nil
 		}
+		return nil, dnsLookupError(err)
 	}
-	return nil
+	addrs, err := resolver.LookupHost(ctx, value)
+	if err == nil && len(addrs) > 0 {
+		return map[string]interface{}{"ip": addrs[0]}, nil
+	}
+	return nil, dnsLookupError(err)
+}
+
+// dnsLookupError は名前やアドレスが存在しないことによるエラーを、一致しなかったものとして nil にします。
+func dnsLookupError(err error) error {
+	var dnsErr *net.DNSError
+	if err == nil || (errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		return nil
+	}
+	return err
 }
 
 // --- ヘルパー関数 ---
 
+// loadConfig は設定ファイルを読み込みます。形式 (JSON / YAML / TOML) は拡張子で判定します。
+// 文字列中の環境変数の参照は展開され、include で指定したファイルも取り込まれます。
 func loadConfig(path string) (*Config, error) {
-	file, err := os.ReadFile(path)
+	doc, err := loadConfigDocument(path, nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not read config file: %w", err)
+		return nil, err
 	}
-	var config Config
-	if err := json.Unmarshal(file, &config); err != nil {
-		return nil, fmt.Errorf("could not parse config JSON: %w", err)
+	config, err := decodeConfigDocument(doc)
+	if err != nil {
+		return nil, err
 	}
+	setConfigDefaults(config)
+	return config, nil
+}
+
+// setConfigDefaults は省略された設定項目に既定値を設定します。
+func setConfigDefaults(config *Config) {
 	for i := range config.Matchers {
 		if config.Matchers[i].Method == "" {
 			config.Matchers[i].Method = "exact"
 		}
 	}
-	return &config, nil
 }
 
 func resolveDataSourcePath(configPath, dataSource string) string {
+	if isRemoteURL(dataSource) {
+		return dataSource
+	}
 	if strings.HasPrefix(dataSource, "~/") {
 		homeDir, err := os.UserHomeDir()
 		if err == nil {
@@ -405,7 +938,7 @@ func resolveDataSourcePath(configPath, dataSource string) string {
 }
 
 func parseMapping(m string) (*Mapping, error) {
-	re := regexp.MustCompile(`^(\S+)\s+as\s+(\S+)(\s+OUTPUT\s+(.*))?$`)
+	re := regexp.MustCompile(`^(\S+)\s+as\s+(\S+)(\s+OUTPUT\s+(.*?))?(\s+INTO\s+(\S+))?$`)
 	matches := re.FindStringSubmatch(m)
 	if len(matches) < 3 {
 		return nil, fmt.Errorf("invalid mapping format: %s", m)
@@ -423,35 +956,64 @@ func parseMapping(m string) (*Mapping, error) {
 				continue
 			}
 			parts := regexp.MustCompile(`\s+as\s+`).Split(pair, 2)
+			source, target := pair, pair
 			if len(parts) == 2 {
-				mapping.OutputMap[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
-			} else {
-				mapping.OutputMap[pair] = pair
+				source, target = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
 			}
+			mapping.OutputMap[source] = target
+			mapping.OutputNames = append(mapping.OutputNames, target)
+		}
+	}
+	if len(matches) > 6 && matches[6] != "" {
+		path, all := strings.CutSuffix(matches[6], "[]")
+		mapping.Into = strings.Split(path, ".")
+		mapping.IntoAll = all
+		if slices.Contains(mapping.Into, "") {
+			return nil, fmt.Errorf("invalid INTO path '%s' in mapping: %s", matches[6], m)
 		}
 	}
 	return mapping, nil
 }
 
 func loadLookupDataFromCSV(path string) (LookupData, error) {
+	var data LookupData
+	err := scanLookupDataFromCSV(path, func(row map[string]string) error {
+		data = append(data, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// scanLookupDataFromCSV はCSVファイルを1行ずつ読み込み、各行を fn に渡します。
+// データ全体をメモリに載せずに処理するために使用します。
+func scanLookupDataFromCSV(path string, fn func(row map[string]string) error) error {
+	return scanLookupDataFromCSVLines(path, func(row map[string]string, _ int) error {
+		return fn(row)
+	})
+}
+
+// scanLookupDataFromCSVLines は scanLookupDataFromCSV と同様ですが、各行の開始行番号も fn に渡します。
+func scanLookupDataFromCSVLines(path string, fn func(row map[string]string, line int) error) error {
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("could not open file: %w", err)
+		return fmt.Errorf("could not open file: %w", err)
 	}
 	defer file.Close()
 	reader := csv.NewReader(file)
 	header, err := reader.Read()
 	if err != nil {
-		return nil, fmt.Errorf("could not read CSV header: %w", err)
+		return fmt.Errorf("could not read CSV header: %w", err)
 	}
-	var data LookupData
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("error reading CSV record: %w", err)
+			return fmt.Errorf("error reading CSV record: %w", err)
 		}
 		row := make(map[string]string)
 		for i, value := range record {
@@ -459,38 +1021,109 @@ func loadLookupDataFromCSV(path string) (LookupData, error) {
 				row[header[i]] = value
 			}
 		}
+		line, _ := reader.FieldPos(0)
+		if err := fn(row, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadLookupDataFromJSON(path string) (LookupData, error) {
+	var data LookupData
+	err := scanLookupDataFromJSON(path, func(row map[string]string) error {
 		data = append(data, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return data, nil
 }
 
-func loadLookupDataFromJSON(path string) (LookupData, error) {
-	file, err := os.ReadFile(path)
+// scanLookupDataFromJSON はJSON配列の要素を1つずつデコードし、各行を fn に渡します。
+func scanLookupDataFromJSON(path string, fn func(row map[string]string) error) error {
+	return scanLookupDataFromJSONLines(path, func(row map[string]string, _ int) error {
+		return fn(row)
+	})
+}
+
+// scanLookupDataFromJSONLines は scanLookupDataFromJSON と同様ですが、各要素の開始行番号も fn に渡します。
+func scanLookupDataFromJSONLines(path string, fn func(row map[string]string, line int) error) error {
+	file, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("could not read file: %w", err)
+		return fmt.Errorf("could not read file: %w", err)
 	}
-	var rawData []map[string]interface{}
-	if err := json.Unmarshal(file, &rawData); err != nil {
-		return nil, fmt.Errorf("could not parse JSON: %w", err)
+	defer file.Close()
+	counter := &lineCounter{r: bufio.NewReader(file)}
+	decoder := json.NewDecoder(counter)
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('[') {
+		return fmt.Errorf("could not parse JSON: expected an array of objects")
 	}
-	var data LookupData
-	for _, rawRow := range rawData {
-		row := make(map[string]string)
-		for key, val := range rawRow {
-			row[key] = fmt.Sprintf("%v", val)
+	for decoder.More() {
+		start := decoder.InputOffset()
+		var rawRow map[string]interface{}
+		if err := decoder.Decode(&rawRow); err != nil {
+			return fmt.Errorf("could not parse JSON: %w", err)
+		}
+		if err := fn(stringifyRow(rawRow), counter.valueLine(start)); err != nil {
+			return err
 		}
-		data = append(data, row)
 	}
-	return data, nil
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("could not parse JSON: %w", err)
+	}
+	return nil
+}
+
+// lineCounter は読み込んだバイト列の改行を数え、オフセットを行番号に変換する io.Reader です。
+// 変換済みの位置より前のデータは保持しないため、大きなファイルでもメモリを消費しません。
+type lineCounter struct {
+	r       io.Reader
+	pending []byte // まだ行番号の計算に使っていないデータ
+	base    int64  // pending の先頭のオフセット
+	line    int    // base の位置の行番号 - 1
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.pending = append(c.pending, p[:n]...)
+	return n, err
+}
+
+// valueLine は offset 以降の空白とカンマを読み飛ばした位置、つまり次の値の開始位置の行番号を返します。
+// json.Decoder.InputOffset は直前のトークンの終わりを指すため、値をデコードした後に呼び出します。
+func (c *lineCounter) valueLine(offset int64) int {
+	skip := int(offset - c.base)
+	for _, b := range c.pending[:skip] {
+		if b == '\n' {
+			c.line++
+		}
+	}
+	c.pending = c.pending[skip:]
+	c.base = offset
+
+	line := c.line
+	for _, b := range c.pending {
+		if b == '\n' {
+			line++
+		} else if b != ' ' && b != '\t' && b != '\r' && b != ',' {
+			break
+		}
+	}
+	return line + 1
 }
 
-func printJSON(data map[string]interface{}) {
+// writeJSONLine はレコードを1行のJSONとして w に書き出します。
+func writeJSONLine(w io.Writer, data map[string]interface{}) {
 	output, err := json.Marshal(data)
 	if err != nil {
 		log.Printf("Warning: Could not marshal result to JSON, skipping: %v", err)
 		return
 	}
-	fmt.Println(string(output))
+	if _, err := fmt.Fprintln(w, string(output)); err != nil {
+		log.Printf("Warning: Could not write record: %v", err)
+	}
 }
 
 // --- 雛形生成機能 ---
@@ -499,49 +1132,57 @@ func printJSON(data map[string]interface{}) {
 func handleGenerateConfig() {
 	genCmd := flag.NewFlagSet("generate-config", flag.ExitOnError)
 	filePath := genCmd.String("file", "", "Path to the data source file (CSV or JSON).")
+	format := genCmd.String("format", "json", "Output format of the configuration: json, yaml, or toml.")
+	sampleRows := genCmd.Int("sample", 10000, "Number of rows to analyze to suggest match methods (0 = all rows).")
+	showStats := genCmd.Bool("stats", false, "Print a report of column statistics to stderr.")
 	genCmd.Parse(os.Args[2:])
 
 	if *filePath == "" {
 		log.Fatal("Error: -file flag is required for generate-config command.")
 	}
-
-	var headers []string
-	var err error
+	if !slices.Contains(configFormats, *format) {
+		log.Fatalf("Error: Unsupported format '%s'. Use json, yaml, or toml.", *format)
+	}
 
 	ext := filepath.Ext(*filePath)
 	switch strings.ToLower(ext) {
-	case ".csv":
-		headers, err = extractHeadersFromCSV(*filePath)
-	case ".json", ".jsonl":
-		headers, err = extractKeysFromJSON(*filePath)
+	case ".csv", ".json", ".jsonl":
 	default:
 		log.Fatalf("Error: Unsupported file type '%s'. Only .csv, .json, and .jsonl are supported.", ext)
 	}
 
+	profiles, rows, err := profileDataSource(*filePath, *sampleRows)
 	if err != nil {
 		log.Fatalf("Error processing file %s: %v", *filePath, err)
 	}
 
 	config := Config{
 		DataSource: *filePath,
-		Matchers:   make([]Matcher, 0, len(headers)),
+		Matchers:   make([]Matcher, 0, len(profiles)),
 	}
+	comments := make([]string, 0, len(profiles))
 
-	for _, header := range headers {
+	// 列の値から推定したマッチング方法を、列の順に出力します。
+	for _, profile := range profiles {
+		method, caseSensitive, _ := profile.suggest()
 		config.Matchers = append(config.Matchers, Matcher{
-			InputField:    header,
-			LookupField:   header,
-			Method:        "exact",
-			CaseSensitive: false,
+			InputField:    profile.Name,
+			LookupField:   profile.Name,
+			Method:        method,
+			CaseSensitive: caseSensitive,
 		})
+		comments = append(comments, profile.comment())
 	}
 
-	output, err := json.MarshalIndent(config, "", "  ")
+	output, err := encodeConfig(&config, *format, comments)
 	if err != nil {
-		log.Fatalf("Error generating json output: %v", err)
+		log.Fatalf("Error generating %s output: %v", *format, err)
 	}
 
 	fmt.Println(string(output))
+	if *showStats {
+		writeColumnReport(os.Stderr, profiles, rows)
+	}
 }
 
 // extractHeadersFromCSV はCSVファイルのヘッダーを抽出します。
@@ -559,72 +1200,3 @@ func extractHeadersFromCSV(path string) ([]string, error) {
 	}
 	return header, nil
 }
-
-// extractKeysFromJSON はJSONファイル内のすべてのキーをスキャンして抽出します。
-// JSON配列とJSONLの両方に対応します。
-func extractKeysFromJSON(path string) ([]string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("could not open file: %w", err)
-	}
-	defer file.Close()
-
-	// ファイルの先頭を少し読んで、JSON配列かJSONLかを判断する
-	reader := bufio.NewReader(file)
-	firstBytes, err := reader.Peek(512) // 先頭512バイトを覗き見
-	if err != nil && err != io.EOF {
-		// ファイルが512バイトより小さい場合、EOFは期待されるがエラーではない
-	}
-
-	// ファイルの読み取り位置を先頭に戻す
-	_, err = file.Seek(0, 0)
-	if err != nil {
-		return nil, fmt.Errorf("could not seek back to the beginning of the file: %w", err)
-	}
-
-	allKeys := make(map[string]struct{})
-
-	trimmedBytes := bytes.TrimSpace(firstBytes)
-	// JSON配列かどうかをチェック
-	if len(trimmedBytes) > 0 && trimmedBytes[0] == '[' {
-		var arr []map[string]interface{}
-		decoder := json.NewDecoder(file)
-		if err := decoder.Decode(&arr); err != nil {
-			return nil, fmt.Errorf("could not parse JSON array: %w", err)
-		}
-		for _, obj := range arr {
-			for k := range obj {
-				allKeys[k] = struct{}{}
-			}
-		}
-	} else { // JSONLと仮定
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := scanner.Bytes()
-			if len(bytes.TrimSpace(line)) == 0 {
-				continue
-			}
-			var data map[string]interface{}
-			if err := json.Unmarshal(line, &data); err != nil {
-				// 有効なJSONオブジェクトではない行は無視する
-				continue
-			}
-			for k := range data {
-				allKeys[k] = struct{}{}
-			}
-		}
-		if err := scanner.Err(); err != nil {
-			return nil, fmt.Errorf("error scanning JSONL file: %w", err)
-		}
-	}
-
-	if len(allKeys) == 0 {
-		return nil, fmt.Errorf("no keys found in JSON file")
-	}
-
-	keys := make([]string, 0, len(allKeys))
-	for k := range allKeys {
-		keys = append(keys, k)
-	}
-	return keys, nil
-}
\ No newline at end of file
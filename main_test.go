@@ -155,6 +155,78 @@ func compareJSONLines(actual, expected []byte) error {
 	return nil
 }
 
+// TestBuildIndexBlackBox builds a key-value index with the build-index subcommand
+// and checks that a kv data source produces the same result as the CSV.
+func TestBuildIndexBlackBox(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "users.db")
+
+	cmd := exec.Command("./"+testBinaryName, "build-index", "-c", "testdata/lookup_config.json", "-lookup-field", "username", "-o", dbPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build-index failed: %v\nOutput:\n%s", err, string(output))
+	}
+
+	configPath := filepath.Join(dir, "kv_config.json")
+	config := `{"type": "kv", "data_source": "users.db", "matchers": [{"input_field": "user", "lookup_field": "username"}]}`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	inputData, err := os.ReadFile("testdata/input.jsonl")
+	if err != nil {
+		t.Fatalf("Failed to read input file: %v", err)
+	}
+	cmd = exec.Command("./"+testBinaryName, "-c", configPath, "-m", "user as username OUTPUT department as dept, role")
+	cmd.Stdin = bytes.NewReader(inputData)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command execution failed: %v\nOutput:\n%s", err, string(output))
+	}
+
+	expectedOutput, err := os.ReadFile("testdata/exact_match.expected.jsonl")
+	if err != nil {
+		t.Fatalf("Failed to read expected output file: %v", err)
+	}
+	if err := compareJSON(output, expectedOutput, true); err != nil {
+		t.Errorf("Output does not match expected result: %v", err)
+	}
+}
+
+// TestValidateBlackBox checks that the validate subcommand prints each problem
+// with its location and exits with a non-zero status.
+func TestValidateBlackBox(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	config := `data_source: ./users.csv
+matchers:
+  - input_field: user
+    lookup_field: username
+    methd: regex
+`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "users.csv"), []byte("username\njdoe\n"), 0600); err != nil {
+		t.Fatalf("Failed to write data source: %v", err)
+	}
+
+	cmd := exec.Command("./"+testBinaryName, "validate", "-c", configPath)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("Expected validate to fail, but it succeeded\nOutput:\n%s", string(output))
+	}
+	expected := configPath + `:5: matchers[0].methd: unknown field "methd" (did you mean "method"?)`
+	if !strings.Contains(string(output), expected) {
+		t.Errorf("Expected output to contain %q, but got:\n%s", expected, string(output))
+	}
+
+	cmd = exec.Command("./"+testBinaryName, "validate", "-c", "testdata/lookup_config.json")
+	output, _ = cmd.CombinedOutput()
+	if !strings.Contains(string(output), "users.csv:2: invalid cidr pattern") {
+		t.Errorf("Expected the invalid CIDR row of users.csv to be reported, but got:\n%s", string(output))
+	}
+}
+
 func TestResolveDataSourcePath(t *testing.T) {
 	// Get home directory for testing ~ expansion
 	homeDir, err := os.UserHomeDir()
@@ -192,15 +264,100 @@ func TestResolveDataSourcePath(t *testing.T) {
 			dataSource:   "./data/users.csv",
 			expectedPath: "/config/dir/data/users.csv",
 		},
+		{
+			name:         "Remote URL",
+			configPath:   "/config/dir/config.json",
+			dataSource:   "https://example.com/tables/users.csv",
+			expectedPath: "https://example.com/tables/users.csv",
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			resolvedPath := resolveDataSourcePath(tc.configPath, tc.dataSource)
 			// Use filepath.Clean to normalize paths for comparison
+			if isRemoteURL(tc.expectedPath) {
+				if resolvedPath != tc.expectedPath {
+					t.Errorf("Expected URL %s, but got %s", tc.expectedPath, resolvedPath)
+				}
+				return
+			}
 			if filepath.Clean(resolvedPath) != filepath.Clean(tc.expectedPath) {
 				t.Errorf("Expected path %s, but got %s", tc.expectedPath, resolvedPath)
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestStatsBlackBox(t *testing.T) {
+	input := "{\"user\": \"jdoe\"}\nnot json\n{\"user\": \"nobody\"}\n{\"client_ip\": \"8.8.8.8\"}\n"
+	cmd := exec.Command("./"+testBinaryName, "-c", "testdata/lookup_config.json", "-m", "user as username OUTPUT department", "--stats", "json")
+	cmd.Stdin = strings.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// The invalid line is skipped, so the command reports it with its exit code.
+	_, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != exitCodeDropped {
+		t.Fatalf("Expected exit code %d, but got %v\nStderr:\n%s", exitCodeDropped, err, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	var report statsReport
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &report); err != nil {
+		t.Fatalf("Could not parse stats from stderr: %v\n%s", err, stderr.String())
+	}
+	if report.RecordsRead != 4 || report.InvalidJSON != 1 || report.Matched != 1 || report.Unmatched != 1 || report.Skipped != 1 || report.Dropped != 1 {
+		t.Errorf("Unexpected stats: %+v", report)
+	}
+}
+
+func TestWhereBlackBox(t *testing.T) {
+	testCases := []struct {
+		where    string
+		kept     []string
+		filtered []string
+	}{
+		{where: "matched", kept: []string{"access"}, filtered: []string{"login", "connect", "scan", "external_access"}},
+		{where: "unmatched", kept: []string{"login", "connect", "scan", "external_access"}, filtered: []string{"access"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.where, func(t *testing.T) {
+			filteredPath := filepath.Join(t.TempDir(), "filtered.jsonl")
+			input, err := os.ReadFile("testdata/input.jsonl")
+			if err != nil {
+				t.Fatalf("Failed to read input: %v", err)
+			}
+			cmd := exec.Command("./"+testBinaryName, "-c", "testdata/lookup_config.json", "-m", "client_ip as ip_range OUTPUT role",
+				"--where", tc.where, "--filtered-output", filteredPath)
+			cmd.Stdin = bytes.NewReader(input)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput:\n%s", err, string(output))
+			}
+			filtered, err := os.ReadFile(filteredPath)
+			if err != nil {
+				t.Fatalf("Failed to read filtered output: %v", err)
+			}
+			if got := eventNames(t, output); !reflect.DeepEqual(got, tc.kept) {
+				t.Errorf("Expected output events %v, but got %v", tc.kept, got)
+			}
+			if got := eventNames(t, filtered); !reflect.DeepEqual(got, tc.filtered) {
+				t.Errorf("Expected filtered events %v, but got %v", tc.filtered, got)
+			}
+		})
+	}
+}
+
+// eventNames returns the "event" field of each JSON line.
+func eventNames(t *testing.T, jsonl []byte) []string {
+	t.Helper()
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(string(jsonl)), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Could not parse %q: %v", line, err)
+		}
+		names = append(names, fmt.Sprint(record["event"]))
+	}
+	return names
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMappingInto(t *testing.T) {
+	testCases := []struct {
+		rule     string
+		names    []string
+		into     []string
+		all      bool
+		hasError bool
+	}{
+		{rule: "user as name OUTPUT dept, title as role INTO enrichment.user", names: []string{"dept", "role"}, into: []string{"enrichment", "user"}},
+		{rule: "ip as network OUTPUT threat INTO threat.matches[]", names: []string{"threat"}, into: []string{"threat", "matches"}, all: true},
+		{rule: "user as name INTO user_info", into: []string{"user_info"}},
+		{rule: "user as name OUTPUT dept", names: []string{"dept"}},
+		{rule: "user as name OUTPUT dept INTO a..b", hasError: true},
+	}
+	for _, tc := range testCases {
+		mapping, err := parseMapping(tc.rule)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("parseMapping(%q): expected an error", tc.rule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parseMapping(%q) failed: %v", tc.rule, err)
+		}
+		if !reflect.DeepEqual(mapping.OutputNames, tc.names) || !reflect.DeepEqual(mapping.Into, tc.into) || mapping.IntoAll != tc.all {
+			t.Errorf("parseMapping(%q): expected %v INTO %v (all: %v), but got %v INTO %v (all: %v)",
+				tc.rule, tc.names, tc.into, tc.all, mapping.OutputNames, mapping.Into, mapping.IntoAll)
+		}
+	}
+}
+
+func TestFindAllMatches(t *testing.T) {
+	data := LookupData{
+		{"network": "10.0.0.0/8", "threat": "a"},
+		{"network": "bad"},
+		{"network": "10.1.0.0/16", "threat": "b"},
+		{"network": "192.168.0.0/16", "threat": "c"},
+	}
+	matcher := &Matcher{LookupField: "network", Method: "cidr"}
+	rows := findAllMatches("10.1.2.3", data, matcher)
+	if len(rows) != 2 || rows[0]["threat"] != "a" || rows[1]["threat"] != "b" {
+		t.Errorf("Expected rows a and b, but got %v", rows)
+	}
+	if rows := findAllMatches("172.16.0.1", data, matcher); rows != nil {
+		t.Errorf("Expected no rows, but got %v", rows)
+	}
+}
+
+func TestProcessObjectInto(t *testing.T) {
+	data := LookupData{
+		{"network": "10.0.0.0/8", "threat": "scanner", "severity": "low"},
+		{"network": "10.1.0.0/16", "threat": "c2", "severity": "high"},
+	}
+	matcher := &Matcher{InputField: "ip", LookupField: "network", Method: "cidr"}
+	newProcessor := func(rule string) *recordProcessor {
+		mapping, err := parseMapping(rule)
+		if err != nil {
+			t.Fatalf("parseMapping failed: %v", err)
+		}
+		return &recordProcessor{mapping: mapping, lookuper: &tableLookuper{data: data, matcher: matcher}, statusField: "_lookup"}
+	}
+
+	t.Run("Nested object", func(t *testing.T) {
+		processor := newProcessor("ip as network OUTPUT threat as name, severity INTO threat.intel")
+		record := map[string]interface{}{"ip": "10.1.2.3", "threat": map[string]interface{}{"source": "edr"}, "severity": "keep"}
+		out, result, _ := processor.processObject(record)
+		expected := map[string]interface{}{"source": "edr", "intel": map[string]interface{}{"name": "scanner", "severity": "low"}}
+		if result != explainMatched || !reflect.DeepEqual(out["threat"], expected) || out["severity"] != "keep" {
+			t.Errorf("Expected %v under threat, but got %v", expected, out)
+		}
+	})
+
+	t.Run("Array of all matches", func(t *testing.T) {
+		processor := newProcessor("ip as network OUTPUT threat INTO enrichment.threats[]")
+		out, _, _ := processor.processObject(map[string]interface{}{"ip": "10.1.2.3"})
+		expected := map[string]interface{}{"threats": []interface{}{
+			map[string]interface{}{"threat": "scanner"},
+			map[string]interface{}{"threat": "c2"},
+		}}
+		if !reflect.DeepEqual(out["enrichment"], expected) {
+			t.Errorf("Expected %v, but got %v", expected, out["enrichment"])
+		}
+		if status := out["_lookup"].(*matchStatus); status.MatchCount != 2 {
+			t.Errorf("Expected a match count of 2, but got %+v", status)
+		}
+		if out, _, _ := processor.processObject(map[string]interface{}{"ip": "8.8.8.8"}); out["enrichment"] != nil {
+			t.Errorf("Expected no enrichment for an unmatched record, but got %v", out)
+		}
+	})
+
+	t.Run("Path through a non-object", func(t *testing.T) {
+		processor := newProcessor("ip as network OUTPUT threat INTO threat.intel")
+		out, result, _ := processor.processObject(map[string]interface{}{"ip": "10.1.2.3", "threat": "existing"})
+		if result != explainMatched || out["threat"] != "existing" {
+			t.Errorf("Expected the existing value to be kept, but got %v", out)
+		}
+	})
+}
+
+func TestProcessInputIntoCSV(t *testing.T) {
+	processor := newTestProcessor(t, "user as name OUTPUT dept INTO lookup.user")
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader("user\nbob\n"), "-", &out, ioFormats{input: "csv", output: "csv"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	expected := "user,lookup\n" + `bob,"{""user"":{""dept"":""Engineering""}}"` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
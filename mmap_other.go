@@ -0,0 +1,20 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// mmapFile は mmap を利用できない環境向けに、ファイル全体をメモリに読み込みます。
+func mmapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read file: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("file is empty")
+	}
+	return data, func() error { return nil }, nil
+}
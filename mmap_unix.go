@@ -0,0 +1,37 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapFile はファイル全体を読み取り専用でメモリにマップします。
+// 戻り値の関数でマップを解除します。
+func mmapFile(path string) ([]byte, func() error, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not stat file: %w", err)
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, nil, fmt.Errorf("file is empty")
+	}
+	if int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("file is too large to map")
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not mmap file: %w", err)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
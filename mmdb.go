@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"strconv"
+)
+
+// --- MaxMind DB (MMDB) データソース ---
+
+// mmdbMetadataMarker はメタデータセクションの開始を示すバイト列です。
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbDataSectionSeparatorSize は検索ツリーとデータセクションの間の区切りのバイト数です。
+const mmdbDataSectionSeparatorSize = 16
+
+// mmdbReader はMaxMind DB形式のファイルを読み込み、IPアドレスを検索します。
+type mmdbReader struct {
+	buf          []byte
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+	dataSection  []byte
+	ipv4Start    uint
+}
+
+// openMMDB はMMDBファイルを読み込み、メタデータを解析します。
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file: %w", err)
+	}
+	return newMMDBReader(buf)
+}
+
+// newMMDBReader はメモリ上のMMDBデータから mmdbReader を生成します。
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	markerIndex := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if markerIndex < 0 {
+		return nil, fmt.Errorf("invalid MMDB file: metadata marker not found")
+	}
+	metaStart := markerIndex + len(mmdbMetadataMarker)
+	metaValue, _, err := (&mmdbDecoder{buf: buf[metaStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MMDB metadata: %w", err)
+	}
+	meta, ok := metaValue.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid MMDB metadata: not a map")
+	}
+
+	r := &mmdbReader{buf: buf}
+	r.nodeCount = mmdbMetaUint(meta, "node_count")
+	r.recordSize = mmdbMetaUint(meta, "record_size")
+	r.ipVersion = mmdbMetaUint(meta, "ip_version")
+	r.databaseType, _ = meta["database_type"].(string)
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported MMDB record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported MMDB ip_version %d", r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	dataStart := treeSize + mmdbDataSectionSeparatorSize
+	if dataStart > uint(markerIndex) {
+		return nil, fmt.Errorf("invalid MMDB file: search tree exceeds file size")
+	}
+	r.dataSection = buf[dataStart:markerIndex]
+
+	// IPv6のデータベースでは、IPv4アドレスは ::/96 の下に格納されています。
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node, err = r.readNode(node, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// mmdbMetaUint はメタデータの数値フィールドを uint として取り出します。
+func mmdbMetaUint(meta map[string]interface{}, key string) uint {
+	if v, ok := meta[key].(uint64); ok {
+		return uint(v)
+	}
+	return 0
+}
+
+// readNode は検索ツリーのノードの左 (bit=0) または右 (bit=1) のレコードを読み出します。
+func (r *mmdbReader) readNode(node uint, bit uint) (uint, error) {
+	offset := node * r.recordSize / 4
+	if offset+r.recordSize/4 > uint(len(r.buf)) {
+		return 0, fmt.Errorf("invalid MMDB file: node %d out of range", node)
+	}
+	b := r.buf[offset:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+	case 28:
+		if bit == 0 {
+			return (uint(b[3])&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return (uint(b[3])&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:])), nil
+	}
+}
+
+// lookup はIPアドレスを検索し、対応するレコードと一致したネットワークのプレフィックス長を返します。
+// 該当するネットワークがない場合、レコードは nil になります。
+func (r *mmdbReader) lookup(ip net.IP) (interface{}, int, error) {
+	node := uint(0)
+	var bits []byte
+	prefixLen := 0
+	if ip4 := ip.To4(); ip4 != nil {
+		bits = ip4
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+			prefixLen = 96
+		}
+	} else {
+		if r.ipVersion == 4 {
+			return nil, 0, nil
+		}
+		bits = ip.To16()
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		var err error
+		node, err = r.readNode(node, bit)
+		if err != nil {
+			return nil, 0, err
+		}
+		prefixLen++
+	}
+
+	if node == r.nodeCount {
+		return nil, 0, nil
+	}
+	if node < r.nodeCount {
+		return nil, 0, fmt.Errorf("invalid MMDB file: search tree is deeper than the address")
+	}
+	offset := node - r.nodeCount - mmdbDataSectionSeparatorSize
+	if offset >= uint(len(r.dataSection)) {
+		return nil, 0, fmt.Errorf("invalid MMDB file: data pointer out of range")
+	}
+	record, _, err := (&mmdbDecoder{buf: r.dataSection}).decode(offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not decode MMDB record: %w", err)
+	}
+	if ip.To4() != nil && r.ipVersion == 6 {
+		prefixLen -= 96
+	}
+	return record, prefixLen, nil
+}
+
+// --- データセクションのデコーダー ---
+
+// mmdbDecoder はMMDBのデータセクション形式の値をデコードします。
+type mmdbDecoder struct {
+	buf []byte
+}
+
+const (
+	mmdbTypeExtended  = 0
+	mmdbTypePointer   = 1
+	mmdbTypeString    = 2
+	mmdbTypeDouble    = 3
+	mmdbTypeBytes     = 4
+	mmdbTypeUint16    = 5
+	mmdbTypeUint32    = 6
+	mmdbTypeMap       = 7
+	mmdbTypeInt32     = 8
+	mmdbTypeUint64    = 9
+	mmdbTypeUint128   = 10
+	mmdbTypeArray     = 11
+	mmdbTypeContainer = 12
+	mmdbTypeEndMarker = 13
+	mmdbTypeBool      = 14
+	mmdbTypeFloat     = 15
+)
+
+// maxMMDBDecodeDepth は入れ子の深さの上限です。不正なファイルによる無限再帰を防ぎます。
+const maxMMDBDecodeDepth = 64
+
+// decode は offset の位置の値をデコードし、値と次の値の位置を返します。
+func (d *mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	return d.decodeDepth(offset, 0)
+}
+
+func (d *mmdbDecoder) decodeDepth(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxMMDBDecodeDepth {
+		return nil, 0, fmt.Errorf("maximum nesting depth exceeded")
+	}
+	typeNum, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typeNum == mmdbTypePointer {
+		pointer, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decodeDepth(pointer, depth+1)
+		return value, next, err
+	}
+
+	switch typeNum {
+	case mmdbTypeMap:
+		result := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decodeDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			value, next, err := d.decodeDepth(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result[keyStr] = value
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbTypeArray:
+		result := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decodeDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result = append(result, value)
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbTypeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("value at offset %d exceeds data section", offset)
+	}
+	data := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typeNum {
+	case mmdbTypeString:
+		return string(data), next, nil
+	case mmdbTypeBytes:
+		return append([]byte(nil), data...), next, nil
+	case mmdbTypeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), next, nil
+	case mmdbTypeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), next, nil
+	case mmdbTypeUint16, mmdbTypeUint32, mmdbTypeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size %d", size)
+		}
+		var v uint64
+		for _, b := range data {
+			v = v<<8 | uint64(b)
+		}
+		return v, next, nil
+	case mmdbTypeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		var v uint32
+		for _, b := range data {
+			v = v<<8 | uint32(b)
+		}
+		return int64(int32(v)), next, nil
+	case mmdbTypeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size %d", size)
+		}
+		return new(big.Int).SetBytes(data), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typeNum)
+	}
+}
+
+// decodeControl はコントロールバイトを解析し、型、サイズ、ペイロードの位置を返します。
+func (d *mmdbDecoder) decodeControl(offset uint) (uint, uint, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("offset %d exceeds data section", offset)
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typeNum := uint(ctrl >> 5)
+	if typeNum == mmdbTypeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("unexpected end of data section")
+		}
+		typeNum = 7 + uint(d.buf[offset])
+		offset++
+	}
+	if typeNum == mmdbTypePointer {
+		return typeNum, uint(ctrl) & 0x1F, offset, nil
+	}
+
+	size := uint(ctrl) & 0x1F
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("unexpected end of data section")
+		}
+		var n uint
+		for _, b := range d.buf[offset : offset+extra] {
+			n = n<<8 | uint(b)
+		}
+		offset += extra
+		switch extra {
+		case 1:
+			size = 29 + n
+		case 2:
+			size = 285 + n
+		default:
+			size = 65821 + n
+		}
+	}
+	return typeNum, size, offset, nil
+}
+
+// decodePointer はポインタの参照先のオフセットと、ポインタの次の位置を返します。
+func (d *mmdbDecoder) decodePointer(ctrlBits uint, offset uint) (uint, uint, error) {
+	pointerSize := (ctrlBits >> 3) + 1
+	if offset+pointerSize > uint(len(d.buf)) {
+		return 0, 0, fmt.Errorf("unexpected end of data section")
+	}
+	var prefix uint
+	if pointerSize != 4 {
+		prefix = ctrlBits & 0x7
+	}
+	n := prefix
+	for _, b := range d.buf[offset : offset+pointerSize] {
+		n = n<<8 | uint(b)
+	}
+	switch pointerSize {
+	case 2:
+		n += 2048
+	case 3:
+		n += 526336
+	}
+	return n, offset + pointerSize, nil
+}
+
+// --- ルックアップ ---
+
+// mmdbLookuper はMMDBの検索ツリーを用いてIPアドレスのルックアップを行います。
+type mmdbLookuper struct {
+	reader *mmdbReader
+}
+
+// newMMDBLookuper はMMDBファイルを開き、mmdbLookuper を生成します。
+func newMMDBLookuper(path string) (*mmdbLookuper, error) {
+	reader, err := openMMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &mmdbLookuper{reader: reader}, nil
+}
+
+// Lookup はIPアドレスに対応するレコードを、ドット区切りのフィールド名に平坦化して返します。
+// IPアドレスとして解釈できない値は「一致なし」として扱います。
+func (m *mmdbLookuper) Lookup(value string) (map[string]string, error) {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, nil
+	}
+	record, _, err := m.reader.lookup(ip)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	flattenMMDBRecord("", record, result)
+	return result, nil
+}
+
+// Explain はIPアドレスで検索木を引いた結果を説明します。
+func (m *mmdbLookuper) Explain(value string) (map[string]string, *lookupExplanation, error) {
+	ex := &lookupExplanation{Source: "mmdb", NormalizedValue: value, Index: "search tree"}
+	reason := "address not found in database"
+	if net.ParseIP(value) == nil {
+		reason = "input value is not an IP address"
+	}
+	result, err := m.Lookup(value)
+	if err != nil {
+		return nil, ex, err
+	}
+	ex.finish(result != nil, reason)
+	return result, ex, nil
+}
+
+// flattenMMDBRecord は入れ子のレコードを "country.iso_code" や "subdivisions.0.names.en"
+// のようなフィールド名に展開します。
+func flattenMMDBRecord(prefix string, value interface{}, out map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			flattenMMDBRecord(join(k), elem, out)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			flattenMMDBRecord(join(strconv.Itoa(i)), elem, out)
+		}
+	case []byte:
+		out[prefix] = fmt.Sprintf("%x", v)
+	case float64:
+		out[prefix] = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		out[prefix] = fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// mmdbTestNetwork is a network and the record stored for it in a test database.
+type mmdbTestNetwork struct {
+	cidr   string
+	record map[string]interface{}
+}
+
+// buildTestMMDB writes a minimal IPv6 MaxMind DB (24-bit records) containing
+// the given networks. IPv4 networks are stored under ::/96 as in GeoLite2.
+func buildTestMMDB(t *testing.T, networks []mmdbTestNetwork) []byte {
+	t.Helper()
+
+	const empty = -1
+	type node struct{ children [2]int } // >= 0: node index, empty, or <= -2: data ref
+	nodes := []node{{children: [2]int{empty, empty}}}
+
+	var data bytes.Buffer
+	for _, n := range networks {
+		_, ipNet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatalf("invalid test CIDR %s: %v", n.cidr, err)
+		}
+		ones, _ := ipNet.Mask.Size()
+		ip := ipNet.IP.To16()
+		if ipNet.IP.To4() != nil {
+			ip = append(make(net.IP, 12), ipNet.IP.To4()...)
+			ones += 96
+		}
+
+		dataRef := -2 - data.Len()
+		encodeMMDBTestValue(&data, n.record)
+
+		current := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[current].children[bit] = dataRef
+				break
+			}
+			if nodes[current].children[bit] < 0 {
+				nodes = append(nodes, node{children: [2]int{empty, empty}})
+				nodes[current].children[bit] = len(nodes) - 1
+			}
+			current = nodes[current].children[bit]
+		}
+	}
+
+	var out bytes.Buffer
+	nodeCount := len(nodes)
+	for _, n := range nodes {
+		for _, child := range n.children {
+			var v int
+			switch {
+			case child == empty:
+				v = nodeCount
+			case child <= -2:
+				v = nodeCount + mmdbDataSectionSeparatorSize + (-2 - child)
+			default:
+				v = child
+			}
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, mmdbDataSectionSeparatorSize))
+	out.Write(data.Bytes())
+	out.Write(mmdbMetadataMarker)
+	encodeMMDBTestValue(&out, map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(6),
+		"database_type":               "Test-ASN",
+		"binary_format_major_version": uint16(2),
+	})
+	return out.Bytes()
+}
+
+// encodeMMDBTestValue encodes the subset of data types used by the tests.
+func encodeMMDBTestValue(buf *bytes.Buffer, value interface{}) {
+	writeControl := func(typeNum int, size int) {
+		sizeBits, extra := size, []byte(nil)
+		if size >= 29 {
+			sizeBits, extra = 29, []byte{byte(size - 29)}
+		}
+		if typeNum <= 7 {
+			buf.WriteByte(byte(typeNum<<5 | sizeBits))
+		} else {
+			buf.WriteByte(byte(sizeBits))
+			buf.WriteByte(byte(typeNum - 7))
+		}
+		buf.Write(extra)
+	}
+	switch v := value.(type) {
+	case string:
+		writeControl(mmdbTypeString, len(v))
+		buf.WriteString(v)
+	case uint16:
+		writeControl(mmdbTypeUint16, 2)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		writeControl(mmdbTypeUint32, 4)
+		binary.Write(buf, binary.BigEndian, v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		writeControl(mmdbTypeBool, size)
+	case []interface{}:
+		writeControl(mmdbTypeArray, len(v))
+		for _, elem := range v {
+			encodeMMDBTestValue(buf, elem)
+		}
+	case map[string]interface{}:
+		writeControl(mmdbTypeMap, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeMMDBTestValue(buf, k)
+			encodeMMDBTestValue(buf, v[k])
+		}
+	}
+}
+
+func TestMMDBLookuper(t *testing.T) {
+	db := buildTestMMDB(t, []mmdbTestNetwork{
+		{
+			cidr: "8.8.8.0/24",
+			record: map[string]interface{}{
+				"autonomous_system_number":       uint32(15169),
+				"autonomous_system_organization": "GOOGLE",
+				"country": map[string]interface{}{
+					"iso_code": "US",
+					"names":    map[string]interface{}{"en": "United States"},
+				},
+				"is_anycast": true,
+			},
+		},
+		{
+			cidr: "2001:db8::/32",
+			record: map[string]interface{}{
+				"country":      map[string]interface{}{"iso_code": "JP"},
+				"subdivisions": []interface{}{map[string]interface{}{"iso_code": "13"}},
+			},
+		},
+	})
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, db, 0600); err != nil {
+		t.Fatalf("Failed to write test database: %v", err)
+	}
+
+	lookuper, err := newMMDBLookuper(path)
+	if err != nil {
+		t.Fatalf("newMMDBLookuper failed: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		value    string
+		expected map[string]string
+	}{
+		{
+			name:  "IPv4 in network",
+			value: "8.8.8.8",
+			expected: map[string]string{
+				"autonomous_system_number":       "15169",
+				"autonomous_system_organization": "GOOGLE",
+				"country.iso_code":               "US",
+				"country.names.en":               "United States",
+				"is_anycast":                     "true",
+			},
+		},
+		{
+			name:  "IPv6 in network",
+			value: "2001:db8::1",
+			expected: map[string]string{
+				"country.iso_code":        "JP",
+				"subdivisions.0.iso_code": "13",
+			},
+		},
+		{name: "IPv4 not in database", value: "1.1.1.1", expected: nil},
+		{name: "Not an IP address", value: "example.com", expected: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := lookuper.Lookup(tc.value)
+			if err != nil {
+				t.Fatalf("Lookup failed: %v", err)
+			}
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected %v, but got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestOpenMMDBInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.mmdb")
+	if err := os.WriteFile(path, []byte("not a maxmind database"), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if _, err := openMMDB(path); err == nil {
+		t.Fatal("Expected an error for an invalid file, but got nil")
+	}
+}
+
+func TestMMDBDecoderPointer(t *testing.T) {
+	// "abc" at offset 0, followed by a pointer to it at offset 4.
+	decoder := &mmdbDecoder{buf: []byte{0x43, 'a', 'b', 'c', 0x20, 0x00}}
+	value, next, err := decoder.decode(4)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if value != "abc" || next != 6 {
+		t.Errorf("Expected (\"abc\", 6), but got (%v, %d)", value, next)
+	}
+}
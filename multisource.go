@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// --- ディレクトリ・globによる複数ファイルのデータソース ---
+
+// sourceFileField は、行の読み込み元ファイル名を格納するフィールド名です。
+const sourceFileField = "_source_file"
+
+// MergeConfig は複数ファイルのデータソースを結合する方法を定義します。
+type MergeConfig struct {
+	DedupeKey     string `json:"dedupe_key,omitempty"`      // 重複とみなす行のキーとなるフィールド
+	Precedence    string `json:"precedence,omitempty"`      // "newest" (既定) または "oldest"
+	AddSourceFile bool   `json:"add_source_file,omitempty"` // 各行に _source_file フィールドを追加する
+}
+
+// isMultiFileSource は、パスがglobパターンまたはディレクトリかどうかを判定します。
+func isMultiFileSource(path string) bool {
+	if strings.ContainsAny(path, "*?[") {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// expandDataSource はglobパターンまたはディレクトリを、対応する形式のファイルの一覧に展開します。
+// ファイルは precedence に従い、優先されるものから順に並べます。
+func expandDataSource(path string, merge *MergeConfig) ([]string, error) {
+	var candidates []string
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read data source directory: %w", err)
+		}
+		for _, entry := range entries {
+			candidates = append(candidates, filepath.Join(path, entry.Name()))
+		}
+	} else {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data_source pattern '%s': %w", path, err)
+		}
+		candidates = matches
+	}
+
+	type sourceFile struct {
+		path    string
+		modTime int64
+	}
+	var files []sourceFile
+	for _, candidate := range candidates {
+		switch strings.ToLower(filepath.Ext(candidate)) {
+		case ".csv", ".json", ".jsonl":
+		default:
+			continue
+		}
+		info, err := os.Stat(candidate)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, sourceFile{path: candidate, modTime: info.ModTime().UnixNano()})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no CSV or JSON files found for data_source '%s'", path)
+	}
+
+	precedence := "newest"
+	if merge != nil && merge.Precedence != "" {
+		precedence = merge.Precedence
+	}
+	var less func(a, b sourceFile) bool
+	switch precedence {
+	case "newest":
+		less = func(a, b sourceFile) bool {
+			if a.modTime != b.modTime {
+				return a.modTime > b.modTime
+			}
+			return a.path > b.path
+		}
+	case "oldest":
+		less = func(a, b sourceFile) bool {
+			if a.modTime != b.modTime {
+				return a.modTime < b.modTime
+			}
+			return a.path < b.path
+		}
+	default:
+		return nil, fmt.Errorf("unsupported merge precedence '%s' (expected 'newest' or 'oldest')", precedence)
+	}
+	sort.Slice(files, func(i, j int) bool { return less(files[i], files[j]) })
+
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return paths, nil
+}
+
+// loadMergedLookupData は複数のデータソースを優先順に読み込み、1つのテーブルに結合します。
+// dedupe_key が指定されている場合、同じキーの行は最も優先されるファイルのものだけを残します。
+// 指定がない場合もテーブルは優先順に並ぶため、最初に一致した行を使う findMatch では優先されるファイルの行が使われます。
+func loadMergedLookupData(paths []string, merge *MergeConfig) (LookupData, error) {
+	var data LookupData
+	err := scanMergedLookupData(paths, merge, func(row map[string]string) error {
+		data = append(data, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// scanMergedLookupData は複数のデータソースの行を、結合後の順序で1行ずつ fn に渡します。
+func scanMergedLookupData(paths []string, merge *MergeConfig, fn func(row map[string]string) error) error {
+	var seen map[string]struct{}
+	if merge != nil && merge.DedupeKey != "" {
+		seen = make(map[string]struct{})
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		err := scanLookupData(path, func(row map[string]string) error {
+			if seen != nil {
+				key, ok := row[merge.DedupeKey]
+				if ok && key != "" {
+					if _, dup := seen[key]; dup {
+						return nil
+					}
+					seen[key] = struct{}{}
+				}
+			}
+			if merge != nil && merge.AddSourceFile {
+				row[sourceFileField] = name
+			}
+			return fn(row)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
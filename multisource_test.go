@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeFeed writes a feed file with the given content and modification time.
+func writeFeed(t *testing.T, dir, name, content string, modTime time.Time) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set time of %s: %v", name, err)
+	}
+	return path
+}
+
+func setupFeeds(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeFeed(t, dir, "2025-01-01.csv", "indicator,severity\nevil.example,low\nold.example,medium\n", base)
+	writeFeed(t, dir, "2025-01-02.csv", "indicator,severity\nevil.example,high\n", base.Add(24*time.Hour))
+	writeFeed(t, dir, "2025-01-03.json", `[{"indicator": "new.example", "severity": "critical"}]`, base.Add(48*time.Hour))
+	writeFeed(t, dir, "README.txt", "not a feed", base)
+	return dir
+}
+
+func TestExpandDataSource(t *testing.T) {
+	dir := setupFeeds(t)
+
+	testCases := []struct {
+		name     string
+		path     string
+		merge    *MergeConfig
+		expected []string
+	}{
+		{
+			name:     "Directory, newest first by default",
+			path:     dir,
+			expected: []string{"2025-01-03.json", "2025-01-02.csv", "2025-01-01.csv"},
+		},
+		{
+			name:     "Glob",
+			path:     filepath.Join(dir, "*.csv"),
+			expected: []string{"2025-01-02.csv", "2025-01-01.csv"},
+		},
+		{
+			name:     "Oldest first",
+			path:     filepath.Join(dir, "*.csv"),
+			merge:    &MergeConfig{Precedence: "oldest"},
+			expected: []string{"2025-01-01.csv", "2025-01-02.csv"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths, err := expandDataSource(tc.path, tc.merge)
+			if err != nil {
+				t.Fatalf("expandDataSource failed: %v", err)
+			}
+			var names []string
+			for _, p := range paths {
+				names = append(names, filepath.Base(p))
+			}
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("Expected %v, but got %v", tc.expected, names)
+			}
+		})
+	}
+
+	if _, err := expandDataSource(filepath.Join(dir, "*.tsv"), nil); err == nil {
+		t.Error("Expected an error when no files match, but got nil")
+	}
+	if _, err := expandDataSource(dir, &MergeConfig{Precedence: "random"}); err == nil {
+		t.Error("Expected an error for an unknown precedence, but got nil")
+	}
+}
+
+func TestLoadMergedLookupData(t *testing.T) {
+	dir := setupFeeds(t)
+	paths, err := expandDataSource(dir, nil)
+	if err != nil {
+		t.Fatalf("expandDataSource failed: %v", err)
+	}
+
+	t.Run("Dedupe key keeps the newest row", func(t *testing.T) {
+		data, err := loadMergedLookupData(paths, &MergeConfig{DedupeKey: "indicator", AddSourceFile: true})
+		if err != nil {
+			t.Fatalf("loadMergedLookupData failed: %v", err)
+		}
+		expected := LookupData{
+			{"indicator": "new.example", "severity": "critical", "_source_file": "2025-01-03.json"},
+			{"indicator": "evil.example", "severity": "high", "_source_file": "2025-01-02.csv"},
+			{"indicator": "old.example", "severity": "medium", "_source_file": "2025-01-01.csv"},
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("Expected %v, but got %v", expected, data)
+		}
+	})
+
+	t.Run("Concatenation still prefers the newest row", func(t *testing.T) {
+		data, err := loadMergedLookupData(paths, nil)
+		if err != nil {
+			t.Fatalf("loadMergedLookupData failed: %v", err)
+		}
+		if len(data) != 4 {
+			t.Fatalf("Expected 4 rows, but got %d", len(data))
+		}
+		result := findMatch("evil.example", data, &Matcher{LookupField: "indicator", Method: "exact"})
+		if result["severity"] != "high" {
+			t.Errorf("Expected the row from the newest file, but got %v", result)
+		}
+		if _, ok := result[sourceFileField]; ok {
+			t.Errorf("Did not expect %s without add_source_file, but got %v", sourceFileField, result)
+		}
+	})
+}
+
+func TestBuildLookuperWithGlobDataSource(t *testing.T) {
+	dir := setupFeeds(t)
+	configPath := filepath.Join(dir, "config.json")
+	config := `{
+  "data_source": "./*.csv",
+  "merge": {"dedupe_key": "indicator", "add_source_file": true},
+  "matchers": [{"input_field": "domain", "lookup_field": "indicator"}]
+}`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	lookuper, _, err := buildLookuper(configPath, &Mapping{InputField: "domain", LookupField: "indicator"}, nil)
+	if err != nil {
+		t.Fatalf("buildLookuper failed: %v", err)
+	}
+	result, err := lookuper.Lookup("evil.example")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	expected := map[string]string{"indicator": "evil.example", "severity": "high", "_source_file": "2025-01-02.csv"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, but got %v", expected, result)
+	}
+}
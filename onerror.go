@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- 不正なレコードの扱い (--on-error) ---
+
+// exitCodeDropped は、処理は完了したが --on-error でレコードを読み飛ばした (または dead-letter に書き出した) 場合の終了コードです。
+const exitCodeDropped = 3
+
+// 失敗したレコードの段階です。
+const (
+	stageParse  = "parse"  // 入力の解析
+	stageMatch  = "match"  // データソースのルックアップ
+	stageDNS    = "dns"    // DNSの問い合わせ
+	stageRender = "render" // --template の適用
+)
+
+// errorPolicy は解析、ルックアップ、DNSの問い合わせ、テンプレートの適用に失敗したレコードの扱いです (--on-error)。
+// メソッドは nil のレシーバでも呼び出すことができ、その場合は "skip" として扱います。
+type errorPolicy struct {
+	mode       string // "skip", "fail", "passthrough", "dead-letter"
+	deadLetter io.WriteCloser
+
+	mu      sync.Mutex
+	dropped int
+}
+
+// recordFailure は失敗したレコードと、その原因です。dead-letter のファイルには1行に1件ずつ書き出します。
+type recordFailure struct {
+	Time   string                 `json:"time"`
+	Stage  string                 `json:"stage"`
+	Error  string                 `json:"error"`
+	Source string                 `json:"source"`
+	Line   int                    `json:"line,omitempty"`
+	Raw    string                 `json:"raw,omitempty"`    // 解析できなかった入力
+	Record map[string]interface{} `json:"record,omitempty"` // ルックアップまたはテンプレートの適用に失敗したレコード
+}
+
+// parseErrorPolicy は --on-error の値 (skip、fail、passthrough、dead-letter=<file>) を解析します。
+// dead-letter のファイルには追記するため、前回までの記録も残ります。
+func parseErrorPolicy(value string) (*errorPolicy, error) {
+	mode, path, hasPath := strings.Cut(value, "=")
+	switch mode {
+	case "skip", "fail", "passthrough":
+		if hasPath {
+			return nil, fmt.Errorf("--on-error %s does not take a file", mode)
+		}
+		return &errorPolicy{mode: mode}, nil
+	case "dead-letter":
+		if path == "" {
+			return nil, fmt.Errorf("--on-error dead-letter requires a file (dead-letter=<file>)")
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("could not open dead-letter file: %w", err)
+		}
+		return &errorPolicy{mode: mode, deadLetter: file}, nil
+	}
+	return nil, fmt.Errorf("invalid --on-error value '%s' (expected skip, fail, passthrough, or dead-letter=<file>)", value)
+}
+
+// handle は失敗したレコードを扱い、そのレコードを (解析できなかった場合は元の入力のまま) 出力するかどうかを返します。
+// "fail" の場合はエラーを返し、呼び出し側はその入力の処理を中止します。
+func (p *errorPolicy) handle(f *recordFailure) (bool, error) {
+	mode := "skip"
+	if p != nil {
+		mode = p.mode
+	}
+	if mode == "passthrough" && f.Stage == stageParse && f.Raw == "" {
+		// 元の入力を取り出せない場合 (CSV) は、そのまま書き出せないため読み飛ばします。
+		mode = "skip"
+	}
+	switch mode {
+	case "fail":
+		// 呼び出し側が入力の名前を加えるため、ここでは行番号だけを含めます。
+		if f.Line == 0 {
+			return false, errors.New(f.Error)
+		}
+		return false, fmt.Errorf("line %d: %s", f.Line, f.Error)
+	case "passthrough":
+		log.Printf("Warning: %s, passing it through.", f.describe())
+		return true, nil
+	case "dead-letter":
+		f.Time = time.Now().UTC().Format(time.RFC3339)
+		data, err := json.Marshal(f)
+		if err != nil {
+			return false, fmt.Errorf("could not write dead-letter record: %w", err)
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if _, err := fmt.Fprintln(p.deadLetter, string(data)); err != nil {
+			return false, fmt.Errorf("could not write dead-letter record: %w", err)
+		}
+		p.dropped++
+		return false, nil
+	}
+	log.Printf("Warning: %s, skipping.", f.describe())
+	if p != nil {
+		p.mu.Lock()
+		p.dropped++
+		p.mu.Unlock()
+	}
+	return false, nil
+}
+
+// describe は失敗の原因と、入力での位置を表す文字列を返します。
+func (f *recordFailure) describe() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("%s (%s)", f.Error, f.Source)
+	}
+	return fmt.Sprintf("%s (%s, line %d)", f.Error, f.Source, f.Line)
+}
+
+// droppedCount は読み飛ばした、または dead-letter に書き出したレコードの件数です。
+func (p *errorPolicy) droppedCount() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
+
+func (p *errorPolicy) Close() error {
+	if p == nil || p.deadLetter == nil {
+		return nil
+	}
+	return p.deadLetter.Close()
+}
+
+// rawRecordWriter は、解析できなかった入力をそのまま書き出す方法が独自の出力形式 (JSON配列など) が実装します。
+// 実装していない形式では、入力を1行として書き出します。
+type rawRecordWriter interface {
+	WriteRaw(raw string) error
+}
+
+// writeRawRecord は --on-error passthrough で、解析できなかった入力をそのまま書き出します。
+func writeRawRecord(writer recordWriter, output io.Writer, raw string) error {
+	if w, ok := writer.(rawRecordWriter); ok {
+		return w.WriteRaw(raw)
+	}
+	_, err := fmt.Fprintln(output, raw)
+	return err
+}
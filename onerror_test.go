@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingLookuper fails for the value "broken" and matches every other value.
+type failingLookuper struct{}
+
+func (failingLookuper) Lookup(value string) (map[string]string, error) {
+	if value == "broken" {
+		return nil, errors.New("backend unavailable")
+	}
+	return map[string]string{"dept": "Sales"}, nil
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	deadLetter := filepath.Join(t.TempDir(), "dead.jsonl")
+	for _, value := range []string{"skip", "fail", "passthrough", "dead-letter=" + deadLetter} {
+		policy, err := parseErrorPolicy(value)
+		if err != nil {
+			t.Errorf("parseErrorPolicy(%q) failed: %v", value, err)
+			continue
+		}
+		policy.Close()
+	}
+	for _, value := range []string{"", "ignore", "dead-letter", "dead-letter=", "skip=file"} {
+		if _, err := parseErrorPolicy(value); err == nil {
+			t.Errorf("parseErrorPolicy(%q): expected an error", value)
+		}
+	}
+}
+
+func TestProcessInputOnError(t *testing.T) {
+	input := `{"user":"alice"}` + "\n" + `{bad` + "\n" + `{"user":"broken"}` + "\n" + `{"user":"bob"}` + "\n"
+	run := func(t *testing.T, mode string) (string, *errorPolicy, error) {
+		t.Helper()
+		policy, err := parseErrorPolicy(mode)
+		if err != nil {
+			t.Fatalf("parseErrorPolicy failed: %v", err)
+		}
+		t.Cleanup(func() { policy.Close() })
+		mapping, _ := parseMapping("user as name OUTPUT dept")
+		processor := &recordProcessor{mapping: mapping, lookuper: failingLookuper{}, onError: policy}
+		var out bytes.Buffer
+		err = processInput(strings.NewReader(input), "app.jsonl", &out, ioFormats{input: "json"}, processor)
+		return out.String(), policy, err
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		out, policy, err := run(t, "skip")
+		expected := `{"dept":"Sales","user":"alice"}` + "\n" + `{"dept":"Sales","user":"bob"}` + "\n"
+		if err != nil || out != expected {
+			t.Errorf("Expected:\n%s\nbut got:\n%s (%v)", expected, out, err)
+		}
+		if policy.droppedCount() != 2 {
+			t.Errorf("Expected 2 dropped records, but got %d", policy.droppedCount())
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		out, _, err := run(t, "fail")
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("Expected an error for line 2, but got %v", err)
+		}
+		if out != `{"dept":"Sales","user":"alice"}`+"\n" {
+			t.Errorf("Expected only the first record, but got:\n%s", out)
+		}
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		out, policy, err := run(t, "passthrough")
+		expected := `{"dept":"Sales","user":"alice"}` + "\n" + "{bad\n" + `{"user":"broken"}` + "\n" + `{"dept":"Sales","user":"bob"}` + "\n"
+		if err != nil || out != expected {
+			t.Errorf("Expected:\n%s\nbut got:\n%s (%v)", expected, out, err)
+		}
+		if policy.droppedCount() != 0 {
+			t.Errorf("Expected no dropped records, but got %d", policy.droppedCount())
+		}
+	})
+
+	t.Run("dead-letter", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dead.jsonl")
+		out, policy, err := run(t, "dead-letter="+path)
+		if err != nil || strings.Count(out, "\n") != 2 {
+			t.Errorf("Expected 2 records in the output, but got:\n%s (%v)", out, err)
+		}
+		policy.Close()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read dead-letter file: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 dead-letter records, but got:\n%s", data)
+		}
+		var parse, match recordFailure
+		json.Unmarshal([]byte(lines[0]), &parse)
+		json.Unmarshal([]byte(lines[1]), &match)
+		if parse.Stage != stageParse || parse.Source != "app.jsonl" || parse.Line != 2 || parse.Raw != "{bad" || parse.Time == "" {
+			t.Errorf("Unexpected parse failure: %+v", parse)
+		}
+		if match.Stage != stageMatch || match.Line != 3 || match.Record["user"] != "broken" || !strings.Contains(match.Error, "backend unavailable") {
+			t.Errorf("Unexpected match failure: %+v", match)
+		}
+	})
+}
+
+func TestProcessInputPassthroughArray(t *testing.T) {
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	processor.onError = &errorPolicy{mode: "passthrough"}
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader(`[{"user":"bob"}, 5]`), "-", &out, ioFormats{input: "json"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	// An element that is not an object stays in the array unchanged.
+	expected := "[\n  {\n    \"dept\": \"Engineering\",\n    \"user\": \"bob\"\n  },\n  5\n]\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+
+	// An array that cannot be parsed at all is one failure, not a fatal error.
+	out.Reset()
+	if err := processInput(strings.NewReader(`[{"user":"bob"}, oops]`), "-", &out, ioFormats{input: "json"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	if out.String() != "[{\"user\":\"bob\"}, oops]\n" {
+		t.Errorf("Expected the input unchanged, but got:\n%s", out.String())
+	}
+}
+
+func TestLineScannerLongLines(t *testing.T) {
+	long := strings.Repeat("x", maxLineSize+10)
+	scanner := newLineScanner(strings.NewReader("one\r\n" + long + "\ntwo\n" + long))
+	var lines []string
+	var tooLong []bool
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		tooLong = append(tooLong, scanner.tooLong)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(lines) != 4 || lines[0] != "one" || lines[2] != "two" {
+		t.Fatalf("Expected 4 lines, but got %d", len(lines))
+	}
+	if tooLong[0] || !tooLong[1] || tooLong[2] || !tooLong[3] || !strings.HasSuffix(lines[1], "...") || len(lines[1]) > 300 {
+		t.Errorf("Expected lines 2 and 4 to be reported as too long (as a short prefix), but got %v", tooLong)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// --- 元のJSONを保つ出力 (--output-format preserve) ---
+
+// preserveWriter は入力のJSONオブジェクトをそのままのバイト列で書き出し、
+// ルックアップで変わったフィールドの値だけを置き換え、追加したフィールドを末尾に挿入します。
+// キーの順序や数値の表記 (大きな整数を含む)、空白はそのまま保たれます。
+type preserveWriter struct {
+	w       io.Writer
+	extra   []string
+	isArray bool
+	count   int
+}
+
+func (p *preserveWriter) Write(rec *inputRecord) error {
+	object, err := enrichRawObject(rec, p.extra)
+	if err != nil {
+		return err
+	}
+	return p.WriteRaw(string(object))
+}
+
+// WriteRaw は JSONの値を、入力が配列であれば配列の要素として、それ以外は1行として書き出します。
+// --on-error passthrough で解析できなかった入力を書き出す場合にも使います。
+func (p *preserveWriter) WriteRaw(raw string) error {
+	if !p.isArray {
+		_, err := fmt.Fprintf(p.w, "%s\n", raw)
+		return err
+	}
+	separator := ",\n  "
+	if p.count == 0 {
+		separator = "[\n  "
+	}
+	p.count++
+	_, err := fmt.Fprintf(p.w, "%s%s", separator, raw)
+	return err
+}
+
+func (p *preserveWriter) Close() error {
+	if !p.isArray {
+		return nil
+	}
+	if p.count == 0 {
+		_, err := fmt.Fprintln(p.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprint(p.w, "\n]\n")
+	return err
+}
+
+// rawMember は元のJSONオブジェクトの1つのメンバーの位置です。
+type rawMember struct {
+	key        string
+	keyEnd     int // キーの閉じ引用符の直後
+	valueStart int
+	valueEnd   int
+}
+
+// enrichRawObject は rec.raw の値が変わったメンバーを置き換え、新しいフィールドを最後のメンバーの後に挿入します。
+// 挿入するフィールドの区切りとコロンの書き方は、元のオブジェクトのものに合わせます。
+func enrichRawObject(rec *inputRecord, extra []string) ([]byte, error) {
+	raw := rec.raw
+	if raw == nil {
+		return json.Marshal(rec.fields)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("could not parse JSON object")
+	}
+	insertAt := int(decoder.InputOffset())
+	var members []rawMember
+	last := make(map[string]int)
+	for decoder.More() {
+		keyTok, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("could not parse JSON object: %w", err)
+		}
+		keyEnd := int(decoder.InputOffset())
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("could not parse JSON object: %w", err)
+		}
+		end := int(decoder.InputOffset())
+		key := keyTok.(string)
+		last[key] = len(members)
+		members = append(members, rawMember{key: key, keyEnd: keyEnd, valueStart: end - len(value), valueEnd: end})
+	}
+
+	var buf bytes.Buffer
+	pos := 0
+	for i, m := range members {
+		value, ok := rec.fields[m.key]
+		// 重複したキーは、デコードした値と同じく最後のものだけを対象にします。
+		if !ok || last[m.key] != i || sameJSONValue(raw[m.valueStart:m.valueEnd], value) {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal field '%s' to JSON: %w", m.key, err)
+		}
+		buf.Write(raw[pos:m.valueStart])
+		buf.Write(encoded)
+		pos = m.valueEnd
+	}
+
+	separator, colon := ",", ":"
+	if n := len(members); n > 0 {
+		insertAt = members[n-1].valueEnd
+		colon = string(raw[members[n-1].keyEnd:members[n-1].valueStart])
+		if n > 1 {
+			between := raw[members[n-2].valueEnd:]
+			separator = string(between[:bytes.IndexByte(between, '"')])
+		}
+	}
+	buf.Write(raw[pos:insertAt])
+	keys := make([]string, 0, len(members))
+	for _, m := range members {
+		keys = append(keys, m.key)
+	}
+	added := 0
+	for _, key := range orderedKeys(&inputRecord{fields: rec.fields, keys: keys}, extra) {
+		if _, ok := last[key]; ok {
+			continue
+		}
+		encodedKey, _ := json.Marshal(key)
+		encoded, err := json.Marshal(rec.fields[key])
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal field '%s' to JSON: %w", key, err)
+		}
+		if added > 0 || len(members) > 0 {
+			buf.WriteString(separator)
+		}
+		added++
+		buf.Write(encodedKey)
+		buf.WriteString(colon)
+		buf.Write(encoded)
+	}
+	buf.Write(raw[insertAt:])
+	return buf.Bytes(), nil
+}
+
+// sameJSONValue は元のJSONの値 raw をデコードした値が value と等しいかどうかを返します。
+func sameJSONValue(raw []byte, value interface{}) bool {
+	if s, ok := value.(string); ok {
+		var original string
+		return json.Unmarshal(raw, &original) == nil && original == s
+	}
+	var original interface{}
+	if err := json.Unmarshal(raw, &original); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(original, value)
+}
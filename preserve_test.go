@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProcessInputPreserve(t *testing.T) {
+	processor := newTestProcessor(t, "user as name OUTPUT dept, title as role")
+	input := `{"zeta":1,"user":"alice","id":12345678901234567890,"n":1.50,"u":"é"}` + "\n" +
+		`{ "user" : "bob", "dept": "old", "role": "Manager" }` + "\n" +
+		`{"user":"nobody","x":[1, 2]}` + "\n" +
+		"{}\n"
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader(input), "-", &out, ioFormats{input: "json", output: "preserve"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	// Key order, number formatting, escapes and spacing are kept; changed values are replaced in place
+	// and new fields are appended in OUTPUT order.
+	expected := `{"zeta":1,"user":"alice","id":12345678901234567890,"n":1.50,"u":"é","dept":"Sales, EMEA","role":"Manager"}` + "\n" +
+		`{ "user" : "bob", "dept": "Engineering", "role": "" }` + "\n" +
+		`{"user":"nobody","x":[1, 2]}` + "\n" +
+		"{}\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
+
+func TestProcessInputPreserveArray(t *testing.T) {
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	processor.statusField = "_lookup"
+	input := "[\n  {\n    \"user\": \"bob\",\n    \"big\": 9007199254740993\n  },\n  {\"user\": \"x\"}\n]\n"
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader(input), "-", &out, ioFormats{input: "json", output: "preserve"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	// New members follow the separator and colon style of the object they are added to.
+	expected := "[\n  {\n    \"user\": \"bob\",\n    \"big\": 9007199254740993,\n    \"dept\": \"Engineering\",\n    " +
+		`"_lookup": {"matched":true,"match_count":1,"matched_pattern":"bob"}` + "\n  },\n" +
+		`  {"user": "x","_lookup": {"matched":false,"match_count":0}}` + "\n]\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
+
+func TestPreserveRequiresJSONInput(t *testing.T) {
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	err := processInput(strings.NewReader("user\nbob\n"), "-", &bytes.Buffer{}, ioFormats{input: "csv", output: "preserve"}, processor)
+	if err == nil {
+		t.Error("Expected an error for CSV input")
+	}
+}
+
+func TestEnrichRawObjectDuplicateKeys(t *testing.T) {
+	// The decoded value of a duplicated key is the last one, so only that one is compared and replaced.
+	rec := &inputRecord{raw: []byte(`{"a":"1","a":"2"}`), fields: map[string]interface{}{"a": "2"}}
+	got, err := enrichRawObject(rec, nil)
+	if err != nil {
+		t.Fatalf("enrichRawObject failed: %v", err)
+	}
+	if string(got) != `{"a":"1","a":"2"}` {
+		t.Errorf("Expected the object unchanged, but got %s", got)
+	}
+	rec.fields["a"] = "3"
+	got, _ = enrichRawObject(rec, nil)
+	if string(got) != `{"a":"1","a":"3"}` {
+		t.Errorf("Expected the last member replaced, but got %s", got)
+	}
+}
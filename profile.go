@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// --- データソースの列の分析 (generate-config) ---
+
+// 推定の閾値です。値の割合は空でない値に対するものです。
+const (
+	profileCIDRRatio    = 0.9 // これ以上がCIDRなら cidr
+	profileAnchorRatio  = 0.5 // これ以上が ^ または $ で固定された正規表現なら regex
+	profileGlobRatio    = 0.5 // これ以上が * または ? を含むなら wildcard
+	profileHashRatio    = 0.9 // これ以上がハッシュ値なら case_sensitive
+	profileSampleValues = 3   // 統計に表示する値の例の数
+)
+
+// hashValuePattern は MD5 / SHA-1 / SHA-256 / SHA-512 の16進表記に一致します。
+var hashValuePattern = regexp.MustCompile(`^(?:[0-9a-fA-F]{32}|[0-9a-fA-F]{40}|[0-9a-fA-F]{64}|[0-9a-fA-F]{128})$`)
+
+// errStopScan はサンプル数に達したときに走査を打ち切るためのエラーです。
+var errStopScan = errors.New("stop scan")
+
+// columnProfile はデータソースの1つの列について、値の統計とマッチング方法の推定に使う集計を保持します。
+type columnProfile struct {
+	Name     string
+	Empty    int // 空または存在しない値の数
+	NonEmpty int
+	distinct map[string]struct{}
+	Samples  []string
+
+	cidr         int // CIDR表記の値
+	anchored     int // ^ または $ で固定された値
+	invalidRegex int
+	globMeta     int // * または ? を含む値 (固定された正規表現を除く)
+	invalidGlob  int
+	hashLike     int
+}
+
+func newColumnProfile(name string) *columnProfile {
+	return &columnProfile{Name: name, distinct: make(map[string]struct{})}
+}
+
+// add は1つの値を集計します。
+func (p *columnProfile) add(value string, present bool) {
+	if !present || value == "" {
+		p.Empty++
+		return
+	}
+	p.NonEmpty++
+	if _, seen := p.distinct[value]; !seen {
+		p.distinct[value] = struct{}{}
+		if len(p.Samples) < profileSampleValues {
+			p.Samples = append(p.Samples, value)
+		}
+	}
+	if strings.Contains(value, "/") {
+		if _, _, err := net.ParseCIDR(value); err == nil {
+			p.cidr++
+		}
+	}
+	anchored := false
+	if _, err := regexp.Compile(value); err != nil {
+		p.invalidRegex++
+	} else if strings.HasPrefix(value, "^") || strings.HasSuffix(value, "$") {
+		p.anchored++
+		anchored = true
+	}
+	// ^scanner-.*$ のような正規表現の * や ? は、ワイルドカードとして数えません。
+	if !anchored && strings.ContainsAny(value, "*?") {
+		p.globMeta++
+	}
+	if _, err := filepath.Match(value, ""); err != nil {
+		p.invalidGlob++
+	}
+	if hashValuePattern.MatchString(value) {
+		p.hashLike++
+	}
+}
+
+// Distinct は空でない値の種類の数です。
+func (p *columnProfile) Distinct() int {
+	return len(p.distinct)
+}
+
+// Uniqueness は空でない値のうち、種類の数の割合 (0〜1) です。
+func (p *columnProfile) Uniqueness() float64 {
+	if p.NonEmpty == 0 {
+		return 0
+	}
+	return float64(p.Distinct()) / float64(p.NonEmpty)
+}
+
+// suggest は値の傾向からマッチング方法を推定し、その理由とともに返します。
+func (p *columnProfile) suggest() (method string, caseSensitive bool, reason string) {
+	n := float64(p.NonEmpty)
+	switch {
+	case p.NonEmpty == 0:
+		return "exact", false, "no values"
+	case float64(p.cidr) >= n*profileCIDRRatio:
+		return "cidr", false, fmt.Sprintf("%d of %d values are CIDR networks", p.cidr, p.NonEmpty)
+	case p.invalidRegex == 0 && float64(p.anchored) >= n*profileAnchorRatio:
+		return "regex", false, fmt.Sprintf("%d of %d values are anchored regular expressions", p.anchored, p.NonEmpty)
+	case p.invalidGlob == 0 && float64(p.globMeta) >= n*profileGlobRatio:
+		return "wildcard", false, fmt.Sprintf("%d of %d values contain * or ?", p.globMeta, p.NonEmpty)
+	case float64(p.hashLike) >= n*profileHashRatio:
+		return "exact", true, fmt.Sprintf("%d of %d values look like hashes", p.hashLike, p.NonEmpty)
+	default:
+		return "exact", false, ""
+	}
+}
+
+// summary は列の統計を1行で表します。
+func (p *columnProfile) summary() string {
+	s := fmt.Sprintf("%s: %d values, %d distinct (%.1f%% unique), %d empty",
+		p.Name, p.NonEmpty, p.Distinct(), p.Uniqueness()*100, p.Empty)
+	if len(p.Samples) > 0 {
+		s += "; e.g. " + strings.Join(p.Samples, ", ")
+	}
+	return s
+}
+
+// comment は生成する設定ファイルの matcher に付けるコメントです。
+func (p *columnProfile) comment() string {
+	method, caseSensitive, reason := p.suggest()
+	if reason == "" {
+		return p.summary()
+	}
+	suggestion := method
+	if caseSensitive {
+		suggestion += ", case-sensitive"
+	}
+	return p.summary() + "\n" + suggestion + ": " + reason
+}
+
+// profileDataSource はデータソースの先頭 sampleRows 行 (0 の場合はすべて) を読み込み、列ごとに集計します。
+// 列の順序は、CSV ではヘッダーの順、JSON では最初に現れた順です。
+// JSON では後の行にしかないキーも列に含めるため、sampleRows 行を超えても、キーの収集のためにファイルの終わりまで読みます。
+func profileDataSource(path string, sampleRows int) ([]*columnProfile, int, error) {
+	var profiles []*columnProfile
+	index := make(map[string]int)
+	addColumn := func(name string) {
+		if _, ok := index[name]; !ok {
+			index[name] = len(profiles)
+			profiles = append(profiles, newColumnProfile(name))
+		}
+	}
+	rows := 0
+	addRow := func(row map[string]string) error {
+		if sampleRows > 0 && rows >= sampleRows {
+			return errStopScan
+		}
+		for _, p := range profiles {
+			value, ok := row[p.Name]
+			p.add(value, ok)
+		}
+		rows++
+		return nil
+	}
+
+	var err error
+	ext := filepath.Ext(path)
+	switch strings.ToLower(ext) {
+	case ".csv":
+		var header []string
+		header, err = extractHeadersFromCSV(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, name := range header {
+			addColumn(name)
+		}
+		err = scanLookupDataFromCSV(path, addRow)
+	case ".json", ".jsonl":
+		err = scanOrderedJSONRecords(path, func(keys []string, row map[string]string) error {
+			for _, key := range keys {
+				if _, ok := index[key]; !ok {
+					addColumn(key)
+					// 前の行にはなかった列として集計します。
+					profiles[index[key]].Empty += rows
+				}
+			}
+			if err := addRow(row); err != errStopScan {
+				return err
+			}
+			// サンプル数に達した後は、キーだけを集めます。
+			return nil
+		})
+		if err == nil && len(profiles) == 0 {
+			err = fmt.Errorf("no keys found in JSON file")
+		}
+	default:
+		return nil, 0, fmt.Errorf("unsupported file type '%s'", ext)
+	}
+	if err != nil && err != errStopScan {
+		return nil, 0, err
+	}
+	return profiles, rows, nil
+}
+
+// scanOrderedJSONRecords はJSON配列またはJSONLのオブジェクトを1つずつ、キーの出現順とともに fn に渡します。
+// JSONLの有効なJSONオブジェクトではない行は無視します。
+func scanOrderedJSONRecords(path string, fn func(keys []string, row map[string]string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	first, err := peekFirstNonSpace(reader)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read file: %w", err)
+	}
+
+	if first == '[' {
+		decoder := json.NewDecoder(reader)
+		if _, err := decoder.Token(); err != nil {
+			return fmt.Errorf("could not parse JSON array: %w", err)
+		}
+		for decoder.More() {
+			keys, obj, err := decodeOrderedObject(decoder)
+			if err != nil {
+				return fmt.Errorf("could not parse JSON array: %w", err)
+			}
+			if err := fn(keys, stringifyRow(obj)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		keys, obj, err := decodeOrderedObject(json.NewDecoder(bytes.NewReader(line)))
+		if err != nil {
+			continue
+		}
+		if err := fn(keys, stringifyRow(obj)); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error scanning JSONL file: %w", err)
+	}
+	return nil
+}
+
+// decodeOrderedObject は次のJSONオブジェクトをデコードし、キーを出現順に返します。
+func decodeOrderedObject(decoder *json.Decoder) ([]string, map[string]interface{}, error) {
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected a JSON object")
+	}
+	var keys []string
+	obj := make(map[string]interface{})
+	for decoder.More() {
+		keyTok, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := keyTok.(string)
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		if _, dup := obj[key]; !dup {
+			keys = append(keys, key)
+		}
+		obj[key] = value
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, nil, err
+	}
+	return keys, obj, nil
+}
+
+// stringifyRow はデータソースの読み込みと同じ方法で、値を文字列に変換します。
+func stringifyRow(obj map[string]interface{}) map[string]string {
+	row := make(map[string]string, len(obj))
+	for key, val := range obj {
+		row[key] = fmt.Sprintf("%v", val)
+	}
+	return row
+}
+
+// writeColumnReport は列の統計と推定したマッチング方法を表形式で出力します。
+func writeColumnReport(w io.Writer, profiles []*columnProfile, rows int) {
+	fmt.Fprintf(w, "Analyzed %d rows.\n", rows)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLUMN\tVALUES\tDISTINCT\tUNIQUE\tEMPTY\tMETHOD\tCASE_SENSITIVE\tREASON")
+	for _, p := range profiles {
+		method, caseSensitive, reason := p.suggest()
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t%d\t%s\t%t\t%s\n",
+			p.Name, p.NonEmpty, p.Distinct(), p.Uniqueness()*100, p.Empty, method, caseSensitive, reason)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestColumnProfileSuggest(t *testing.T) {
+	testCases := []struct {
+		name          string
+		values        []string
+		method        string
+		caseSensitive bool
+	}{
+		{name: "Networks", values: []string{"10.0.0.0/8", "192.168.0.0/16", "2001:db8::/32"}, method: "cidr"},
+		{name: "Mostly plain IPs", values: []string{"10.0.0.0/8", "192.168.1.10", "192.168.1.25"}, method: "exact"},
+		{name: "Globs", values: []string{"bot-*", "crawler-??", "plain"}, method: "wildcard"},
+		{name: "Anchored regexes", values: []string{"^admin-[0-9]+$", "^svc-.*", "root"}, method: "regex"},
+		{name: "Unanchored regex-like values", values: []string{"a.*", "b.*", "c"}, method: "wildcard"},
+		{name: "A single glob", values: []string{"bot-*", "alice", "bob"}, method: "exact"},
+		{name: "Anchored regexes are not globs", values: []string{"jdoe", "asmith", "b-*", "^scanner-.*$"}, method: "exact"},
+		{name: "Invalid regex is not regex", values: []string{"^[a-z", "^b$"}, method: "exact"},
+		{name: "Hashes", values: []string{strings.Repeat("a", 32), strings.Repeat("B", 64), strings.Repeat("0", 40)}, method: "exact", caseSensitive: true},
+		{name: "Names", values: []string{"Alice", "Bob", ""}, method: "exact"},
+		{name: "Empty", values: []string{"", ""}, method: "exact"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newColumnProfile("col")
+			for _, v := range tc.values {
+				p.add(v, true)
+			}
+			method, caseSensitive, _ := p.suggest()
+			if method != tc.method || caseSensitive != tc.caseSensitive {
+				t.Errorf("Expected (%s, %t), but got (%s, %t)", tc.method, tc.caseSensitive, method, caseSensitive)
+			}
+		})
+	}
+}
+
+func TestProfileDataSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rows.jsonl")
+	data := `{"user": "alice", "net": "10.0.0.0/8"}
+not json
+{"user": "bob", "net": "192.168.0.0/16", "hash": "` + strings.Repeat("f", 64) + `"}
+{"user": "bob", "zeta": "", "net": "172.16.0.0/12"}
+`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+
+	profiles, rows, err := profileDataSource(path, 0)
+	if err != nil {
+		t.Fatalf("profileDataSource failed: %v", err)
+	}
+	if rows != 3 {
+		t.Errorf("Expected 3 rows, but got %d", rows)
+	}
+	var summaries []string
+	for _, p := range profiles {
+		summaries = append(summaries, p.summary())
+	}
+	// Columns are in order of first appearance, not map order.
+	expected := []string{
+		"user: 3 values, 2 distinct (66.7% unique), 0 empty; e.g. alice, bob",
+		"net: 3 values, 3 distinct (100.0% unique), 0 empty; e.g. 10.0.0.0/8, 192.168.0.0/16, 172.16.0.0/12",
+		"hash: 1 values, 1 distinct (100.0% unique), 2 empty; e.g. " + strings.Repeat("f", 64),
+		"zeta: 0 values, 0 distinct (0.0% unique), 3 empty",
+	}
+	if !reflect.DeepEqual(summaries, expected) {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(summaries, "\n"))
+	}
+
+	sampled, rows, err := profileDataSource(path, 1)
+	if err != nil {
+		t.Fatalf("profileDataSource failed: %v", err)
+	}
+	// Keys that first appear after the sample limit are still columns, without statistics.
+	if rows != 1 || len(sampled) != 4 {
+		t.Fatalf("Expected 1 row and 4 columns when sampling, but got %d rows and %d columns", rows, len(sampled))
+	}
+	if hash := sampled[2]; hash.Name != "hash" || hash.NonEmpty != 0 || hash.Empty != 1 {
+		t.Errorf("Expected hash to have no sampled values, but got %s", hash.summary())
+	}
+}
+
+func TestEncodeConfigComments(t *testing.T) {
+	config := &Config{
+		DataSource: "users.csv",
+		Matchers: []Matcher{
+			{InputField: "user", LookupField: "user", Method: "exact"},
+			{InputField: "net", LookupField: "net", Method: "cidr"},
+		},
+	}
+	comments := []string{"user: 2 values", "net: 2 values\ncidr: 2 of 2 values are CIDR networks"}
+
+	testCases := map[string]string{
+		"yaml": "matchers:\n  # user: 2 values\n  - input_field: user",
+		"toml": "# net: 2 values\n# cidr: 2 of 2 values are CIDR networks\n[[matchers]]\ncase_sensitive = false\ninput_field = \"net\"",
+	}
+	for format, want := range testCases {
+		t.Run(format, func(t *testing.T) {
+			data, err := encodeConfig(config, format, comments)
+			if err != nil {
+				t.Fatalf("encodeConfig failed: %v", err)
+			}
+			if !strings.Contains(string(data), want) {
+				t.Errorf("Expected output to contain:\n%s\nbut got:\n%s", want, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"text/template"
+)
+
+// --- 入出力のレコード形式 ---
+
+// 入力と出力の形式です。
+var (
+	inputFormats  = []string{"json", "csv", "logfmt", "syslog"}
+	outputFormats = []string{"json", "preserve", "csv", "logfmt", "cef"}
+)
+
+// ioFormats は --input-format と --output-format で指定する入出力の形式です。
+// template が nil でなければ、出力の形式の代わりにテンプレートで書き出します (--template)。
+type ioFormats struct {
+	input    string
+	output   string
+	template *template.Template
+}
+
+// inputRecord は入力から読み込んだ1件のレコードです。
+type inputRecord struct {
+	fields map[string]interface{}
+	keys   []string // 入力でのフィールドの順序 (JSONでは nil)
+	header string   // 入力行のうちレコードの本文より前の部分 (syslog ヘッダー)
+	raw    []byte   // 入力での元のJSONオブジェクト (preserve で出力する場合のみ)
+	line   int      // 入力での行番号 (JSON配列では要素の番号、いずれも1から)
+}
+
+// set はフィールドを設定します。新しいフィールドは入力での順序の末尾に加えます。
+func (r *inputRecord) set(key string, value interface{}) {
+	if _, ok := r.fields[key]; !ok {
+		r.keys = append(r.keys, key)
+	}
+	r.fields[key] = value
+}
+
+// orderedKeys は順序を持つ形式 (logfmt、CEF) で出力するキーの順序を決めます。
+// 入力のキーの順の後に、extra (OUTPUT の指定順) のキー、それ以外の追加されたキーを名前順に続けます。
+func orderedKeys(rec *inputRecord, extra []string) []string {
+	keys := make([]string, 0, len(rec.fields))
+	seen := make(map[string]bool, len(rec.fields))
+	add := func(key string) {
+		if _, ok := rec.fields[key]; ok && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	ordered := rec.keys
+	if ordered == nil {
+		// JSONには順序がないため、追加したフィールド以外を名前順に並べます。
+		for key := range rec.fields {
+			if !slices.Contains(extra, key) {
+				ordered = append(ordered, key)
+			}
+		}
+		sort.Strings(ordered)
+	}
+	for _, key := range ordered {
+		add(key)
+	}
+	for _, key := range extra {
+		add(key)
+	}
+	var rest []string
+	for key := range rec.fields {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// recordError は読み飛ばして処理を続けられる、1件のレコードの解析エラーです。
+type recordError struct {
+	format string // "JSON", "CSV", "logfmt", "syslog" など
+	raw    string // 解析できなかった入力 (CSVでは空)
+	line   int    // 入力での行番号 (JSON配列では要素の番号、配列全体の場合は 0)
+	err    error
+}
+
+func (e *recordError) Error() string {
+	if e.line == 0 {
+		return fmt.Sprintf("could not parse input as %s: %v", e.format, e.err)
+	}
+	return fmt.Sprintf("could not parse line as %s: %v", e.format, e.err)
+}
+
+func (e *recordError) Unwrap() error {
+	return e.err
+}
+
+// maxLineSize は1行のレコードの最大のバイト数です。これを超える行は解析エラーとして読み飛ばします。
+const maxLineSize = 1024 * 1024
+
+// errLineTooLong は maxLineSize を超える行の解析エラーです。
+var errLineTooLong = fmt.Errorf("line exceeds the maximum size of %d bytes", maxLineSize)
+
+// lineScanner は bufio.Scanner と同様に1行ずつ読み込みます。
+// bufio.Scanner は長すぎる行でそれ以降を読めなくなるため、maxLineSize を超える行は読み飛ばして tooLong で知らせ、
+// 続く行を読み続けられるようにします。
+type lineScanner struct {
+	*bufio.Scanner
+	tooLong  bool   // 直前の行が maxLineSize を超えていた (Bytes はその先頭の一部)
+	skipping bool   // 長すぎる行を読み飛ばしている
+	prefix   []byte // 読み飛ばしている行の先頭
+}
+
+func newLineScanner(input io.Reader) *lineScanner {
+	s := &lineScanner{Scanner: bufio.NewScanner(input)}
+	s.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	s.Split(s.splitLines)
+	return s
+}
+
+// splitLines は bufio.ScanLines と同じく行末の改行 (と \r) を除いて行を返します。
+// バッファが maxLineSize に達しても改行がない場合は、その行の残りを読み捨てます。
+func (s *lineScanner) splitLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, s.token(bytes.TrimSuffix(data[:i], []byte("\r"))), nil
+	}
+	if atEOF && (len(data) > 0 || s.skipping) {
+		return len(data), s.token(bytes.TrimSuffix(data, []byte("\r"))), nil
+	}
+	if len(data) >= maxLineSize {
+		if !s.skipping {
+			s.skipping = true
+			s.prefix = bytes.Clone(data[:256])
+		}
+		return len(data), nil, nil
+	}
+	return 0, nil, nil
+}
+
+func (s *lineScanner) token(line []byte) []byte {
+	s.tooLong = s.skipping
+	if s.skipping {
+		s.skipping = false
+		return append(s.prefix, "..."...)
+	}
+	return line
+}
+
+// recordReader は入力からレコードを1件ずつ読み込みます。
+// 入力の終わりでは io.EOF を、読み飛ばせる不正なレコードでは *recordError を返します。
+type recordReader interface {
+	Read() (*inputRecord, error)
+}
+
+// recordWriter はレコードを出力の形式で書き出します。Close は書き出しを完了させます (閉じ括弧など)。
+type recordWriter interface {
+	Write(rec *inputRecord) error
+	Close() error
+}
+
+// newRecordReader は format の入力を読み込む recordReader を生成します。
+func newRecordReader(format string, input io.Reader) (recordReader, error) {
+	switch format {
+	case "", "json":
+		return newJSONRecordReader(input)
+	case "csv":
+		return newCSVRecordReader(input)
+	case "logfmt":
+		return newLogfmtRecordReader(input), nil
+	case "syslog":
+		return newSyslogRecordReader(input), nil
+	default:
+		return nil, fmt.Errorf("unsupported input format '%s'", format)
+	}
+}
+
+// newRecordWriter は format で書き出す recordWriter を生成します。
+// extraColumns はルックアップで追加するフィールドで、CSVのヘッダーや logfmt、CEF の行の末尾に加えます。
+func newRecordWriter(format string, output io.Writer, reader recordReader, extraColumns []string) (recordWriter, error) {
+	switch format {
+	case "", "json":
+		if r, ok := reader.(*jsonRecordReader); ok && r.isArray {
+			return &jsonArrayWriter{w: output}, nil
+		}
+		return &jsonLinesWriter{w: output}, nil
+	case "preserve":
+		r, ok := reader.(*jsonRecordReader)
+		if !ok {
+			return nil, fmt.Errorf("output format 'preserve' requires JSON input")
+		}
+		r.keepRaw = true
+		return &preserveWriter{w: output, extra: extraColumns, isArray: r.isArray}, nil
+	case "csv":
+		var header []string
+		if r, ok := reader.(*csvRecordReader); ok {
+			header = r.header
+		}
+		return newCSVRecordWriter(output, header, extraColumns), nil
+	case "logfmt":
+		return &logfmtRecordWriter{w: output, extra: extraColumns}, nil
+	case "cef":
+		return &cefRecordWriter{w: output, extra: extraColumns}, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format '%s'", format)
+	}
+}
+
+// --- JSON ---
+
+// jsonRecordReader はJSON配列またはJSONL (単一のJSONを含む) を読み込みます。
+// JSON配列は全体を読み込んでから、JSONLは1行ずつ処理します。
+type jsonRecordReader struct {
+	isArray bool
+	array   []json.RawMessage
+	invalid *recordError // 配列全体を解析できなかった場合のエラー
+	scanner *lineScanner
+	keepRaw bool // レコードに元のJSONを残すかどうか
+	line    int  // 読み込んだ行 (JSON配列では要素) の数
+}
+
+func newJSONRecordReader(input io.Reader) (*jsonRecordReader, error) {
+	reader := bufio.NewReader(input)
+	first, err := peekFirstNonSpace(reader)
+	if err == io.EOF {
+		return &jsonRecordReader{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read input: %w", err)
+	}
+
+	if first == '[' {
+		inputBytes, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("could not read input: %w", err)
+		}
+		var dataArray []json.RawMessage
+		if err := json.Unmarshal(inputBytes, &dataArray); err != nil {
+			// 配列全体を1件の解析エラーとして扱います。
+			raw := string(bytes.TrimSpace(inputBytes))
+			return &jsonRecordReader{invalid: &recordError{format: "JSON array", raw: raw, err: err}}, nil
+		}
+		return &jsonRecordReader{isArray: true, array: dataArray}, nil
+	}
+	return &jsonRecordReader{scanner: newLineScanner(reader)}, nil
+}
+
+func (r *jsonRecordReader) Read() (*inputRecord, error) {
+	if r.invalid != nil {
+		err := r.invalid
+		r.invalid = nil
+		return nil, err
+	}
+	if r.scanner == nil {
+		if len(r.array) == 0 {
+			return nil, io.EOF
+		}
+		element := r.array[0]
+		r.array = r.array[1:]
+		r.line++
+		var data map[string]interface{}
+		if err := json.Unmarshal(element, &data); err != nil {
+			return nil, &recordError{format: "JSON", raw: string(element), line: r.line, err: err}
+		}
+		rec := &inputRecord{fields: data, line: r.line}
+		if r.keepRaw {
+			rec.raw = element
+		}
+		return rec, nil
+	}
+
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Bytes()
+		if r.scanner.tooLong {
+			return nil, &recordError{format: "JSON", raw: string(line), line: r.line, err: errLineTooLong}
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(line, &data); err != nil {
+			return nil, &recordError{format: "JSON", raw: string(line), line: r.line, err: err}
+		}
+		rec := &inputRecord{fields: data, line: r.line}
+		if r.keepRaw {
+			rec.raw = bytes.Clone(bytes.TrimSpace(line))
+		}
+		return rec, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read input: %w", err)
+	}
+	return nil, io.EOF
+}
+
+// jsonLinesWriter はレコードを1行ずつJSONとして書き出します。
+type jsonLinesWriter struct {
+	w io.Writer
+}
+
+func (j *jsonLinesWriter) Write(rec *inputRecord) error {
+	writeJSONLine(j.w, rec.fields)
+	return nil
+}
+
+func (j *jsonLinesWriter) Close() error {
+	return nil
+}
+
+// jsonArrayWriter はレコードを整形したJSON配列の要素として逐次書き出します。
+// 出力は配列全体を json.MarshalIndent した場合と同じです。
+type jsonArrayWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonArrayWriter) Write(rec *inputRecord) error {
+	element, err := json.MarshalIndent(rec.fields, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal result to JSON: %w", err)
+	}
+	separator := ",\n  "
+	if j.count == 0 {
+		separator = "[\n  "
+	}
+	j.count++
+	_, err = fmt.Fprintf(j.w, "%s%s", separator, element)
+	return err
+}
+
+// WriteRaw は JSON配列の要素のうちオブジェクトでなかったもの (--on-error passthrough) を、そのまま配列の要素として書き出します。
+func (j *jsonArrayWriter) WriteRaw(raw string) error {
+	separator := ",\n  "
+	if j.count == 0 {
+		separator = "[\n  "
+	}
+	j.count++
+	_, err := fmt.Fprintf(j.w, "%s%s", separator, raw)
+	return err
+}
+
+func (j *jsonArrayWriter) Close() error {
+	if j.count == 0 {
+		_, err := fmt.Fprintln(j.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprint(j.w, "\n]\n")
+	return err
+}
+
+// --- CSV ---
+
+// csvRecordReader は1行目をヘッダーとするCSVを読み込みます。値はすべて文字列になります。
+type csvRecordReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+func newCSVRecordReader(input io.Reader) (*csvRecordReader, error) {
+	reader := csv.NewReader(input)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &csvRecordReader{reader: reader}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read CSV header: %w", err)
+	}
+	return &csvRecordReader{reader: reader, header: header}, nil
+}
+
+func (r *csvRecordReader) Read() (*inputRecord, error) {
+	if r.header == nil {
+		return nil, io.EOF
+	}
+	row, err := r.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// encoding/csv は元の行を返さないため、raw は空のままです。
+			return nil, &recordError{format: "CSV", line: parseErr.Line, err: err}
+		}
+		return nil, fmt.Errorf("could not read CSV input: %w", err)
+	}
+	fields := make(map[string]interface{}, len(r.header))
+	for i, name := range r.header {
+		fields[name] = row[i]
+	}
+	line, _ := r.reader.FieldPos(0)
+	return &inputRecord{fields: fields, keys: r.header, line: line}, nil
+}
+
+// csvRecordWriter はレコードをCSVとして書き出します。
+// 列は入力のヘッダー (JSON入力では最初のレコードのフィールド名の順) に、追加するフィールドを加えたものです。
+// 値は必要な場合のみ引用符で囲まれ、カンマや改行を含む値もそのまま往復できます。
+type csvRecordWriter struct {
+	w       *csv.Writer
+	columns []string
+	extra   []string
+	started bool
+}
+
+func newCSVRecordWriter(output io.Writer, header, extraColumns []string) *csvRecordWriter {
+	c := &csvRecordWriter{w: csv.NewWriter(output), extra: extraColumns}
+	if header != nil {
+		c.columns = appendMissing(append([]string(nil), header...), extraColumns)
+	}
+	return c
+}
+
+// appendMissing は columns にない names を順に追加します。
+func appendMissing(columns, names []string) []string {
+	seen := make(map[string]bool, len(columns))
+	for _, name := range columns {
+		seen[name] = true
+	}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+func (c *csvRecordWriter) writeHeader() error {
+	c.started = true
+	return c.w.Write(c.columns)
+}
+
+func (c *csvRecordWriter) Write(rec *inputRecord) error {
+	if c.columns == nil {
+		keys := rec.keys
+		if keys == nil {
+			// 最初のレコードはルックアップ済みのため、追加したフィールドは末尾に回します。
+			keys = make([]string, 0, len(rec.fields))
+			for key := range rec.fields {
+				if !slices.Contains(c.extra, key) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+		}
+		c.columns = appendMissing(append([]string(nil), keys...), c.extra)
+	}
+	if !c.started {
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+	row := make([]string, len(c.columns))
+	for i, name := range c.columns {
+		row[i] = csvCellValue(rec.fields[name])
+	}
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Close はレコードがなかった場合もヘッダーが分かっていれば書き出します。
+func (c *csvRecordWriter) Close() error {
+	if !c.started && c.columns != nil {
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvCellValue はフィールドの値をCSVのセルの文字列にします。文字列以外はJSONで表します。
+func csvCellValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
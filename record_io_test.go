@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestProcessor returns a processor that looks up "user" in a small user table.
+func newTestProcessor(t *testing.T, mappingRule string) *recordProcessor {
+	t.Helper()
+	mapping, err := parseMapping(mappingRule)
+	if err != nil {
+		t.Fatalf("parseMapping failed: %v", err)
+	}
+	data := LookupData{
+		{"name": "alice", "dept": "Sales, EMEA", "title": "Manager"},
+		{"name": "bob", "dept": "Engineering", "title": ""},
+	}
+	matcher := &Matcher{InputField: mapping.InputField, LookupField: mapping.LookupField, Method: "exact"}
+	return &recordProcessor{mapping: mapping, lookuper: &tableLookuper{data: data, matcher: matcher}}
+}
+
+func TestProcessInputCSV(t *testing.T) {
+	input := "user,note\n" +
+		"Alice,\"quoted, \"\"value\"\"\"\n" +
+		"carol,\"two\nlines\"\n" +
+		"bob,short,extra\n" +
+		"bob,\n"
+	processor := newTestProcessor(t, "user as name OUTPUT dept as department, title")
+
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader(input), "-", &out, ioFormats{input: "csv", output: "csv"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	// The row with the wrong number of fields is skipped; the header gains the OUTPUT fields.
+	expected := "user,note,department,title\n" +
+		"Alice,\"quoted, \"\"value\"\"\",\"Sales, EMEA\",Manager\n" +
+		"carol,\"two\nlines\",,\n" +
+		"bob,,Engineering,\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
+
+func TestProcessInputCSVToJSON(t *testing.T) {
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader("user,n\nbob,1\n"), "-", &out, ioFormats{input: "csv", output: "json"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	expected := `{"dept":"Engineering","n":"1","user":"bob"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, out.String())
+	}
+}
+
+func TestProcessInputJSONToCSV(t *testing.T) {
+	processor := newTestProcessor(t, "user as name OUTPUT title, dept")
+	processor.statusField = "_lookup"
+	input := `{"user": "alice", "count": 3}` + "\n" + `{"user": "nobody", "count": 1, "other": true}` + "\n"
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader(input), "-", &out, ioFormats{output: "csv"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	// Columns come from the first record in name order, followed by the added fields;
+	// non-string values are written as JSON.
+	expected := "count,user,title,dept,_lookup\n" +
+		`3,alice,Manager,"Sales, EMEA","{""matched"":true,""match_count"":1,""matched_pattern"":""alice""}"` + "\n" +
+		`1,nobody,,,"{""matched"":false,""match_count"":0}"` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
+
+func TestProcessInputEmptyCSV(t *testing.T) {
+	processor := newTestProcessor(t, "user as name OUTPUT dept")
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader("user,note\n"), "-", &out, ioFormats{input: "csv", output: "csv"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	if out.String() != "user,note,dept\n" {
+		t.Errorf("Expected only the header, but got %q", out.String())
+	}
+}
+
+func TestJSONArrayWriterMatchesMarshalIndent(t *testing.T) {
+	records := []map[string]interface{}{
+		{"a": "1", "nested": map[string]interface{}{"b": []interface{}{1.0, 2.0}}},
+		{"c": nil},
+	}
+	var out bytes.Buffer
+	writer := &jsonArrayWriter{w: &out}
+	for _, r := range records {
+		if err := writer.Write(&inputRecord{fields: r}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	expected, _ := json.MarshalIndent(records, "", "  ")
+	if out.String() != string(expected)+"\n" {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
+
+func TestParseMappingOutputNames(t *testing.T) {
+	mapping, err := parseMapping("ip as network OUTPUT threat as ioc_threat, severity, source as ioc_source")
+	if err != nil {
+		t.Fatalf("parseMapping failed: %v", err)
+	}
+	expected := []string{"ioc_threat", "severity", "ioc_source"}
+	if !reflect.DeepEqual(mapping.OutputNames, expected) {
+		t.Errorf("Expected %v, but got %v", expected, mapping.OutputNames)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- ルックアップデータのホットリロード ---
+
+// reloadableLookuper は、バックグラウンドで再構築したルックアップ処理に差し替え可能な Lookuper です。
+// 差し替えは書き込みロックの下で行うため、実行中の Lookup が終わってから古いデータが解放されます。
+type reloadableLookuper struct {
+	mu      sync.RWMutex
+	current Lookuper
+	source  string // current を読み込んだ設定のデータソース名 (--status-field)
+
+	configPath string
+	mapping    *Mapping
+	paths      []string // 監視対象のファイル
+	loaded     string   // 読み込み時点の監視対象のフィンガープリント
+}
+
+// newReloadableLookuper はルックアップ処理を構築し、再読み込みに必要な状態とともに保持します。
+// 読み込み中の変更を見逃さないよう、フィンガープリントは読み込みの前に取得します。
+func newReloadableLookuper(configPath string, mapping *Mapping, stats *runStats) (*reloadableLookuper, error) {
+	paths := watchedPaths(configPath)
+	fingerprint := fingerprintFiles(paths)
+	initial, config, err := buildLookuper(configPath, mapping, stats)
+	if err != nil {
+		return nil, err
+	}
+	return &reloadableLookuper{
+		current:    initial,
+		source:     dataSourceName(config),
+		configPath: configPath,
+		mapping:    mapping,
+		paths:      paths,
+		loaded:     fingerprint,
+	}, nil
+}
+
+// Lookup は現在のルックアップ処理に委譲します。
+func (r *reloadableLookuper) Lookup(value string) (map[string]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current.Lookup(value)
+}
+
+// LookupAll は現在のルックアップ処理に、一致するすべての行の検索を委譲します。
+func (r *reloadableLookuper) LookupAll(value string) ([]map[string]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return lookupAll(r.current, value)
+}
+
+// sourceName は現在のルックアップ処理を読み込んだ設定のデータソース名です。
+func (r *reloadableLookuper) sourceName() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.source
+}
+
+// Explain は現在のルックアップ処理に説明を委譲します。
+func (r *reloadableLookuper) Explain(value string) (map[string]string, *lookupExplanation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return explainLookup(r.current, value)
+}
+
+// cacheStats は現在のルックアップ処理がキャッシュを持っていれば、そのヒット数とミス数を返します。
+func (r *reloadableLookuper) cacheStats() (hits, misses int64, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if reporter, ok := r.current.(cacheStatsReporter); ok {
+		return reporter.cacheStats()
+	}
+	return 0, 0, false
+}
+
+// swap はルックアップ処理を差し替え、古いものが io.Closer であれば閉じます。
+func (r *reloadableLookuper) swap(next Lookuper, source string) {
+	r.mu.Lock()
+	previous := r.current
+	r.current, r.source = next, source
+	r.mu.Unlock()
+
+	if closer, ok := previous.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Warning: Could not release previous lookup data: %v", err)
+		}
+	}
+}
+
+// watch は設定ファイルとデータソースの更新をポーリングで監視し、変更があれば再読み込みします。
+// 書き込み途中のファイルを読まないよう、変更後の状態が1周期のあいだ変わらないことを確認してから再読み込みします。
+// 新しいデータの読み込みや検証に失敗した場合は、古いデータを使い続けます。
+// stop が閉じられると監視を終了します。
+func (r *reloadableLookuper) watch(interval time.Duration, stop <-chan struct{}) {
+	pending := r.loaded
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := fingerprintFiles(r.paths)
+		if current == r.loaded || current != pending {
+			pending = current
+			continue
+		}
+		r.reload()
+		pending = r.loaded
+	}
+}
+
+// reload はルックアップ処理を再構築し、検証に成功した場合のみ差し替えます。
+func (r *reloadableLookuper) reload() {
+	paths := watchedPaths(r.configPath)
+	fingerprint := fingerprintFiles(paths)
+	// 失敗した場合も同じ状態で再試行し続けないよう、結果にかかわらず状態を記録します。
+	r.paths, r.loaded = paths, fingerprint
+
+	next, config, err := buildLookuper(r.configPath, r.mapping, nil)
+	if err == nil {
+		err = validateLookuper(next)
+	}
+	if err != nil {
+		log.Printf("Warning: Reload failed, keeping previous lookup data: %v", err)
+		return
+	}
+	r.swap(next, dataSourceName(config))
+	log.Printf("Reloaded lookup data from %s", r.configPath)
+}
+
+// validateLookuper は再読み込みしたデータが差し替えに適しているかを確認します。
+// 書き込み途中で空になったファイルなどを取り込まないよう、空のテーブルは拒否します。
+func validateLookuper(l Lookuper) error {
+	if table, ok := l.(*tableLookuper); ok && len(table.data) == 0 {
+		return fmt.Errorf("data source has no rows")
+	}
+	return nil
+}
+
+// watchedPaths は監視対象のファイル (設定ファイルと include されたファイル、データソース、スナップショット) を返します。
+// ディレクトリやglobのデータソースでは、そのディレクトリと一致する各ファイルを監視します。
+// URLのデータソースは監視できないため含めません。
+func watchedPaths(configPath string) []string {
+	paths := configFiles(configPath)
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return paths
+	}
+	if config.Type != "http" && config.DataSource != "" && !isRemoteURL(config.DataSource) {
+		dataSourcePath := resolveDataSourcePath(configPath, config.DataSource)
+		if isMultiFileSource(dataSourcePath) {
+			// ファイルの追加・削除を検知するため、ディレクトリ自体も監視します。
+			dir := dataSourcePath
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				dir = filepath.Dir(dataSourcePath)
+			}
+			paths = append(paths, dir)
+			files, _ := expandDataSource(dataSourcePath, config.Merge)
+			paths = append(paths, files...)
+		} else {
+			paths = append(paths, dataSourcePath)
+		}
+	}
+	if config.Snapshot != "" {
+		paths = append(paths, resolveDataSourcePath(configPath, config.Snapshot))
+	}
+	return paths
+}
+
+// fingerprintFiles はファイルのサイズと更新時刻から、変更検知用の文字列を作ります。
+func fingerprintFiles(paths []string) string {
+	var b strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:missing\n", path)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadableLookuperWatch(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	csvPath := filepath.Join(dir, "users.csv")
+	writeFile := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	writeFile(configPath, `{"data_source": "users.csv", "matchers": [{"input_field": "user", "lookup_field": "username"}]}`)
+	writeFile(csvPath, "username,department\njdoe,Sales\n")
+
+	mapping := &Mapping{InputField: "user", LookupField: "username"}
+	reloadable, err := newReloadableLookuper(configPath, mapping, nil)
+	if err != nil {
+		t.Fatalf("newReloadableLookuper failed: %v", err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go reloadable.watch(10*time.Millisecond, stop)
+
+	department := func() string {
+		row, err := reloadable.Lookup("jdoe")
+		if err != nil {
+			t.Fatalf("Lookup failed: %v", err)
+		}
+		return row["department"]
+	}
+	waitFor := func(expected string) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) {
+			if department() == expected {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Timed out waiting for department=%s, still %s", expected, department())
+	}
+
+	// An updated table is picked up.
+	writeFile(csvPath, "username,department\njdoe,Engineering\n")
+	waitFor("Engineering")
+
+	// A table that fails validation is ignored and the previous one is kept.
+	writeFile(csvPath, "username,department\n")
+	time.Sleep(100 * time.Millisecond)
+	if got := department(); got != "Engineering" {
+		t.Errorf("Expected the previous table to be kept, but department is %q", got)
+	}
+
+	// A broken config is ignored as well.
+	writeFile(configPath, `{"data_source": `)
+	time.Sleep(100 * time.Millisecond)
+	if got := department(); got != "Engineering" {
+		t.Errorf("Expected the previous table to be kept, but department is %q", got)
+	}
+
+	// Once everything is valid again, it is reloaded.
+	writeFile(configPath, `{"data_source": "users.csv", "matchers": [{"input_field": "user", "lookup_field": "username"}]} `)
+	writeFile(csvPath, "username,department\njdoe,Support\n")
+	waitFor("Support")
+}
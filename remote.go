@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --- リモートのデータソース ---
+
+// RemoteSourceConfig は data_source にURLを指定した場合のダウンロード設定です。
+type RemoteSourceConfig struct {
+	CacheDir string `json:"cache_dir,omitempty"` // 既定値はユーザーキャッシュディレクトリ配下の lookup-go
+	Checksum string `json:"checksum,omitempty"`  // "sha256:<hex>" 形式
+	Timeout  string `json:"timeout,omitempty"`   // ダウンロードのタイムアウト (既定値 "60s")
+}
+
+const defaultRemoteTimeout = 60 * time.Second
+
+// remoteCacheMeta はキャッシュしたファイルの条件付きリクエスト用の情報です。
+type remoteCacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// isRemoteURL は data_source がHTTP(S)のURLかどうかを判定します。
+func isRemoteURL(dataSource string) bool {
+	return strings.HasPrefix(dataSource, "https://") || strings.HasPrefix(dataSource, "http://")
+}
+
+// defaultRemoteCacheDir は cache_dir が未指定の場合のキャッシュディレクトリを返します。
+func defaultRemoteCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "lookup-go"), nil
+}
+
+// fetchRemoteDataSource はURLのデータソースをキャッシュディレクトリにダウンロードし、
+// ローカルのパスを返します。ETag / Last-Modified による条件付きリクエストで更新を確認し、
+// サーバーに接続できない場合はキャッシュ済みのファイルを使用します。
+func fetchRemoteDataSource(rawURL, cacheDir string, config *RemoteSourceConfig) (string, error) {
+	if config == nil {
+		config = &RemoteSourceConfig{}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid data_source URL: %w", err)
+	}
+	ext := path.Ext(u.Path)
+	if ext == "" {
+		return "", fmt.Errorf("cannot determine data_source format from URL '%s'", rawURL)
+	}
+	timeout, err := parseDurationOrDefault(config.Timeout, defaultRemoteTimeout)
+	if err != nil {
+		return "", fmt.Errorf("invalid remote.timeout: %w", err)
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return "", fmt.Errorf("could not create cache directory: %w", err)
+	}
+
+	urlHash := sha256.Sum256([]byte(rawURL))
+	baseName := hex.EncodeToString(urlHash[:16])
+	cachedPath := filepath.Join(cacheDir, baseName+ext)
+	metaPath := filepath.Join(cacheDir, baseName+".meta.json")
+
+	meta, _ := readRemoteCacheMeta(metaPath)
+	_, statErr := os.Stat(cachedPath)
+	hasCache := statErr == nil
+
+	newMeta, err := downloadRemote(rawURL, cachedPath, meta, hasCache, timeout, config.Checksum)
+	if err != nil {
+		if !hasCache {
+			return "", err
+		}
+		log.Printf("Warning: Could not refresh %s, using cached copy: %v", rawURL, err)
+	} else if newMeta != nil {
+		if err := writeRemoteCacheMeta(metaPath, newMeta); err != nil {
+			log.Printf("Warning: Could not write cache metadata: %v", err)
+		}
+	}
+
+	if err := verifyChecksum(cachedPath, config.Checksum); err != nil {
+		return "", err
+	}
+	return cachedPath, nil
+}
+
+// downloadRemote は条件付きGETを実行し、更新があれば cachedPath を置き換えます。
+// 304 Not Modified の場合は nil のメタ情報を返します。
+func downloadRemote(rawURL, cachedPath string, meta *remoteCacheMeta, hasCache bool, timeout time.Duration, checksum string) (*remoteCacheMeta, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	if hasCache && meta != nil && meta.URL == rawURL {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not download data_source: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && hasCache {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not download data_source: unexpected status %s", resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(cachedPath), ".download-*")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("could not download data_source: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("could not write temporary file: %w", err)
+	}
+	// 破損したファイルでキャッシュを上書きしないよう、置き換える前に検証します。
+	if err := verifyChecksum(tmp.Name(), checksum); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), cachedPath); err != nil {
+		return nil, fmt.Errorf("could not update cached data_source: %w", err)
+	}
+
+	return &remoteCacheMeta{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// verifyChecksum はファイルのハッシュが "sha256:<hex>" 形式の期待値と一致するか検証します。
+// expected が空の場合は何もしません。
+func verifyChecksum(filePath, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	algo, want, ok := strings.Cut(expected, ":")
+	if !ok || !strings.EqualFold(algo, "sha256") {
+		return fmt.Errorf("unsupported checksum format '%s' (expected 'sha256:<hex>')", expected)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("could not open file for checksum: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return fmt.Errorf("could not read file for checksum: %w", err)
+	}
+	got := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(got, want) {
+		return fmt.Errorf("checksum mismatch: expected sha256:%s, got sha256:%s", want, got)
+	}
+	return nil
+}
+
+func readRemoteCacheMeta(metaPath string) (*remoteCacheMeta, error) {
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	var meta remoteCacheMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func writeRemoteCacheMeta(metaPath string, meta *remoteCacheMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, data, 0600)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFetchRemoteDataSource(t *testing.T) {
+	const body = "username,department\njdoe,Sales\n"
+	const etag = `"v1"`
+	sum := sha256.Sum256([]byte(body))
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	var notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	rawURL := server.URL + "/tables/users.csv"
+	cacheDir := t.TempDir()
+	config := &RemoteSourceConfig{Checksum: checksum}
+
+	// First fetch downloads the file.
+	localPath, err := fetchRemoteDataSource(rawURL, cacheDir, config)
+	if err != nil {
+		t.Fatalf("First fetch failed: %v", err)
+	}
+	if !strings.HasSuffix(localPath, ".csv") {
+		t.Errorf("Expected cached file to keep the .csv extension, got %s", localPath)
+	}
+	content, err := os.ReadFile(localPath)
+	if err != nil || string(content) != body {
+		t.Fatalf("Unexpected cached content: %q (err: %v)", content, err)
+	}
+
+	// Second fetch is a conditional request answered with 304.
+	if _, err := fetchRemoteDataSource(rawURL, cacheDir, config); err != nil {
+		t.Fatalf("Second fetch failed: %v", err)
+	}
+	if atomic.LoadInt32(&notModified) != 1 {
+		t.Errorf("Expected one conditional request, got %d", notModified)
+	}
+
+	// With the server gone, the cached copy is used.
+	server.Close()
+	offlinePath, err := fetchRemoteDataSource(rawURL, cacheDir, config)
+	if err != nil {
+		t.Fatalf("Offline fetch failed: %v", err)
+	}
+	if offlinePath != localPath {
+		t.Errorf("Expected offline fetch to return %s, got %s", localPath, offlinePath)
+	}
+}
+
+func TestFetchRemoteDataSourceChecksumMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tampered\n"))
+	}))
+	defer server.Close()
+
+	config := &RemoteSourceConfig{Checksum: "sha256:" + strings.Repeat("0", 64)}
+	if _, err := fetchRemoteDataSource(server.URL+"/users.csv", t.TempDir(), config); err == nil {
+		t.Fatal("Expected a checksum mismatch error, but got nil")
+	}
+}
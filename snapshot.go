@@ -0,0 +1,983 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- コンパイル済みスナップショット ---
+//
+// スナップショットは Config から生成するバイナリ形式のファイルで、mmap してすぐに使用できます。
+// すべての数値はリトルエンディアンで、以下のセクションで構成されます。
+//
+//	ヘッダー       (snapshotHeaderSize バイト)
+//	文字列テーブル  オフセット配列 [count+1]uint64 と文字列本体
+//	行セクション    列名の文字列ID [colCount]uint32 と各セルの文字列ID [rowCount*colCount]uint32
+//	索引           matcher ごとの索引 (完全一致のハッシュ表、ソート済みCIDR範囲、パターン一覧)
+//	matcher 表     [matcherCount] x 32バイト
+
+const (
+	snapshotMagic      = "LKSNAP01"
+	snapshotHeaderSize = 128
+	snapshotNoValue    = 0xFFFFFFFF
+	snapshotNoParent   = -1
+
+	snapshotIndexExact   = 1
+	snapshotIndexCIDR    = 2
+	snapshotIndexPattern = 3
+
+	snapshotMatcherEntrySize = 32
+	snapshotExactSlotSize    = 16
+	snapshotCIDR4EntrySize   = 16
+	snapshotCIDR6EntrySize   = 40
+	snapshotPatternEntrySize = 8
+)
+
+// snapshotSource は、スナップショットの生成元のデータソースを識別する情報です。
+type snapshotSource struct {
+	Checksum [sha256.Size]byte
+	Size     int64
+	ModTime  int64
+}
+
+// fingerprintSource はデータソースのサイズ、更新時刻、SHA-256を計算します。
+func fingerprintSource(path string) (snapshotSource, error) {
+	var src snapshotSource
+	info, err := os.Stat(path)
+	if err != nil {
+		return src, err
+	}
+	sum, err := sha256File(path)
+	if err != nil {
+		return src, err
+	}
+	src.Checksum = sum
+	src.Size = info.Size()
+	src.ModTime = info.ModTime().UnixNano()
+	return src, nil
+}
+
+func sha256File(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	file, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return sum, err
+	}
+	copy(sum[:], hash.Sum(nil))
+	return sum, nil
+}
+
+// normalizeLookupValue は matcher の大文字小文字の設定に従って値を正規化します。
+func normalizeLookupValue(value string, matcher *Matcher) string {
+	if matcher.CaseSensitive {
+		return value
+	}
+	return strings.ToLower(value)
+}
+
+// ipNetworkRange は ParseCIDR の結果を、net.IPNet.Contains と同じ規則で
+// アドレスファミリーごとの開始・終了アドレスに変換します。
+func ipNetworkRange(ipNet *net.IPNet) (start, end net.IP) {
+	ip := ipNet.IP.To4()
+	mask := ipNet.Mask
+	if ip == nil {
+		ip = ipNet.IP.To16()
+	} else if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+	start = make(net.IP, len(ip))
+	end = make(net.IP, len(ip))
+	for i := range ip {
+		start[i] = ip[i] & mask[i]
+		end[i] = start[i] | ^mask[i]
+	}
+	return start, end
+}
+
+// --- 生成 ---
+
+// snapshotCIDREntry はCIDR索引の1エントリです。
+type snapshotCIDREntry struct {
+	start, end net.IP
+	row        uint32
+	parent     int32
+}
+
+type snapshotPatternEntry struct {
+	pattern uint32
+	row     uint32
+}
+
+// snapshotBuilder はデータソースの行を取り込み、スナップショットを書き出します。
+type snapshotBuilder struct {
+	stringIDs   map[string]uint32
+	strings     []string
+	columnIDs   map[string]int
+	columnNames []string
+	rows        [][]uint32
+}
+
+func newSnapshotBuilder() *snapshotBuilder {
+	return &snapshotBuilder{
+		stringIDs: make(map[string]uint32),
+		columnIDs: make(map[string]int),
+	}
+}
+
+func (b *snapshotBuilder) intern(s string) uint32 {
+	if id, ok := b.stringIDs[s]; ok {
+		return id
+	}
+	id := uint32(len(b.strings))
+	b.stringIDs[s] = id
+	b.strings = append(b.strings, s)
+	return id
+}
+
+func (b *snapshotBuilder) addRow(row map[string]string) error {
+	if len(b.rows) >= snapshotNoValue {
+		return fmt.Errorf("too many rows for a snapshot")
+	}
+	cells := make([]uint32, len(b.columnNames))
+	for i := range cells {
+		cells[i] = snapshotNoValue
+	}
+	for key, value := range row {
+		col, ok := b.columnIDs[key]
+		if !ok {
+			col = len(b.columnNames)
+			b.columnIDs[key] = col
+			b.columnNames = append(b.columnNames, key)
+			b.intern(key)
+			cells = append(cells, snapshotNoValue)
+		}
+		cells[col] = b.intern(value)
+	}
+	b.rows = append(b.rows, cells)
+	return nil
+}
+
+// cell は行の列の値を返します。
+func (b *snapshotBuilder) cell(row int, column string) (string, bool) {
+	col, ok := b.columnIDs[column]
+	if !ok || col >= len(b.rows[row]) || b.rows[row][col] == snapshotNoValue {
+		return "", false
+	}
+	return b.strings[b.rows[row][col]], true
+}
+
+// buildExactIndex は正規化したキーから最初の行へのオープンアドレス法のハッシュ表を作成します。
+func (b *snapshotBuilder) buildExactIndex(matcher *Matcher) []byte {
+	first := make(map[string]uint32)
+	var keys []string
+	for r := range b.rows {
+		value, ok := b.cell(r, matcher.LookupField)
+		if !ok {
+			continue
+		}
+		key := normalizeLookupValue(value, matcher)
+		if _, exists := first[key]; !exists {
+			first[key] = uint32(r)
+			keys = append(keys, key)
+		}
+	}
+
+	slotCount := uint64(8)
+	for slotCount < uint64(len(keys))*2 {
+		slotCount <<= 1
+	}
+	slots := make([]byte, 8+slotCount*snapshotExactSlotSize)
+	binary.LittleEndian.PutUint64(slots, slotCount)
+	table := slots[8:]
+	for i := uint64(0); i < slotCount; i++ {
+		binary.LittleEndian.PutUint32(table[i*snapshotExactSlotSize+12:], snapshotNoValue)
+	}
+	for _, key := range keys {
+		h := snapshotHash(key)
+		for i := h & (slotCount - 1); ; i = (i + 1) & (slotCount - 1) {
+			slot := table[i*snapshotExactSlotSize:]
+			if binary.LittleEndian.Uint32(slot[12:]) != snapshotNoValue {
+				continue
+			}
+			binary.LittleEndian.PutUint64(slot, h)
+			binary.LittleEndian.PutUint32(slot[8:], b.intern(key))
+			binary.LittleEndian.PutUint32(slot[12:], first[key])
+			break
+		}
+	}
+	return slots
+}
+
+// buildCIDRIndex はCIDRを開始アドレス順に並べ、各範囲を包含する親範囲への参照を付けます。
+// CIDRは入れ子か互いに素のどちらかであるため、親をたどることで包含するすべての範囲を列挙できます。
+func (b *snapshotBuilder) buildCIDRIndex(matcher *Matcher) []byte {
+	var v4, v6 []snapshotCIDREntry
+	seen := make(map[string]bool)
+	for r := range b.rows {
+		value, ok := b.cell(r, matcher.LookupField)
+		if !ok {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(normalizeLookupValue(value, matcher))
+		if err != nil {
+			continue
+		}
+		start, end := ipNetworkRange(ipNet)
+		key := string(start) + string(end)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		entry := snapshotCIDREntry{start: start, end: end, row: uint32(r)}
+		if len(start) == net.IPv4len {
+			v4 = append(v4, entry)
+		} else {
+			v6 = append(v6, entry)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, entries := range [][]snapshotCIDREntry{v4, v6} {
+		sort.Slice(entries, func(i, j int) bool {
+			if c := bytes.Compare(entries[i].start, entries[j].start); c != 0 {
+				return c < 0
+			}
+			return bytes.Compare(entries[i].end, entries[j].end) > 0
+		})
+		var stack []int
+		for i := range entries {
+			for len(stack) > 0 && bytes.Compare(entries[stack[len(stack)-1]].end, entries[i].start) < 0 {
+				stack = stack[:len(stack)-1]
+			}
+			entries[i].parent = snapshotNoParent
+			if len(stack) > 0 {
+				entries[i].parent = int32(stack[len(stack)-1])
+			}
+			stack = append(stack, i)
+		}
+		binary.Write(&buf, binary.LittleEndian, uint64(len(entries)))
+		for _, e := range entries {
+			buf.Write(e.start)
+			buf.Write(e.end)
+			binary.Write(&buf, binary.LittleEndian, e.row)
+			binary.Write(&buf, binary.LittleEndian, e.parent)
+		}
+	}
+	return buf.Bytes()
+}
+
+// buildPatternIndex はワイルドカード・正規表現のパターンを行の順に並べます。
+func (b *snapshotBuilder) buildPatternIndex(matcher *Matcher) []byte {
+	var entries []snapshotPatternEntry
+	for r := range b.rows {
+		value, ok := b.cell(r, matcher.LookupField)
+		if !ok {
+			continue
+		}
+		entries = append(entries, snapshotPatternEntry{pattern: b.intern(normalizeLookupValue(value, matcher)), row: uint32(r)})
+	}
+	buf := make([]byte, 8+len(entries)*snapshotPatternEntrySize)
+	binary.LittleEndian.PutUint64(buf, uint64(len(entries)))
+	for i, e := range entries {
+		binary.LittleEndian.PutUint32(buf[8+i*snapshotPatternEntrySize:], e.pattern)
+		binary.LittleEndian.PutUint32(buf[12+i*snapshotPatternEntrySize:], e.row)
+	}
+	return buf
+}
+
+func snapshotHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func snapshotIndexKind(method string) (uint32, error) {
+	switch method {
+	case "exact":
+		return snapshotIndexExact, nil
+	case "cidr":
+		return snapshotIndexCIDR, nil
+	case "wildcard", "regex":
+		return snapshotIndexPattern, nil
+	default:
+		return 0, fmt.Errorf("unknown match method '%s'", method)
+	}
+}
+
+// buildSnapshot はデータソースを読み込み、config のすべての matcher の索引を含むスナップショットを outPath に書き出します。
+func buildSnapshot(sourcePath string, matchers []Matcher, outPath string) error {
+	source, err := fingerprintSource(sourcePath)
+	if err != nil {
+		return fmt.Errorf("could not read data source: %w", err)
+	}
+
+	b := newSnapshotBuilder()
+	if err := scanLookupData(sourcePath, b.addRow); err != nil {
+		return err
+	}
+
+	indexes := make([][]byte, len(matchers))
+	kinds := make([]uint32, len(matchers))
+	for i := range matchers {
+		m := &matchers[i]
+		kind, err := snapshotIndexKind(m.Method)
+		if err != nil {
+			return err
+		}
+		kinds[i] = kind
+		switch kind {
+		case snapshotIndexExact:
+			indexes[i] = b.buildExactIndex(m)
+		case snapshotIndexCIDR:
+			indexes[i] = b.buildCIDRIndex(m)
+		case snapshotIndexPattern:
+			indexes[i] = b.buildPatternIndex(m)
+		}
+		b.intern(m.LookupField)
+		b.intern(m.Method)
+	}
+
+	tmpPath := outPath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not create snapshot: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	if err := writeSnapshot(file, b, matchers, kinds, indexes, source); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write snapshot: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("could not write snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, outPath); err != nil {
+		return fmt.Errorf("could not write snapshot: %w", err)
+	}
+	return nil
+}
+
+// writeSnapshot は各セクションを書き出し、最後にヘッダーを先頭に書き込みます。
+func writeSnapshot(file *os.File, b *snapshotBuilder, matchers []Matcher, kinds []uint32, indexes [][]byte, source snapshotSource) error {
+	w := bufio.NewWriter(file)
+	var offset uint64
+	write := func(data []byte) error {
+		n, err := w.Write(data)
+		offset += uint64(n)
+		return err
+	}
+	u32 := func(v uint32) error {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], v)
+		return write(buf[:])
+	}
+	u64 := func(v uint64) error {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], v)
+		return write(buf[:])
+	}
+
+	if err := write(make([]byte, snapshotHeaderSize)); err != nil {
+		return err
+	}
+
+	// 文字列テーブル
+	stringsOffset := offset
+	var pos uint64
+	for _, s := range b.strings {
+		if err := u64(pos); err != nil {
+			return err
+		}
+		pos += uint64(len(s))
+	}
+	if err := u64(pos); err != nil {
+		return err
+	}
+	for _, s := range b.strings {
+		if err := write([]byte(s)); err != nil {
+			return err
+		}
+	}
+
+	// 行セクション
+	rowsOffset := offset
+	colCount := len(b.columnNames)
+	for _, name := range b.columnNames {
+		if err := u32(b.stringIDs[name]); err != nil {
+			return err
+		}
+	}
+	for _, cells := range b.rows {
+		for col := 0; col < colCount; col++ {
+			v := uint32(snapshotNoValue)
+			if col < len(cells) {
+				v = cells[col]
+			}
+			if err := u32(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 索引
+	indexOffsets := make([]uint64, len(indexes))
+	for i, index := range indexes {
+		indexOffsets[i] = offset
+		if err := write(index); err != nil {
+			return err
+		}
+	}
+
+	// matcher 表
+	matchersOffset := offset
+	for i := range matchers {
+		caseSensitive := uint32(0)
+		if matchers[i].CaseSensitive {
+			caseSensitive = 1
+		}
+		for _, v := range []uint32{b.stringIDs[matchers[i].LookupField], b.stringIDs[matchers[i].Method], caseSensitive, kinds[i]} {
+			if err := u32(v); err != nil {
+				return err
+			}
+		}
+		if err := u64(indexOffsets[i]); err != nil {
+			return err
+		}
+		if err := u64(uint64(len(indexes[i]))); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	header := make([]byte, snapshotHeaderSize)
+	copy(header, snapshotMagic)
+	copy(header[16:48], source.Checksum[:])
+	binary.LittleEndian.PutUint64(header[48:], uint64(source.Size))
+	binary.LittleEndian.PutUint64(header[56:], uint64(source.ModTime))
+	binary.LittleEndian.PutUint64(header[64:], stringsOffset)
+	binary.LittleEndian.PutUint64(header[72:], uint64(len(b.strings)))
+	binary.LittleEndian.PutUint64(header[80:], rowsOffset)
+	binary.LittleEndian.PutUint32(header[88:], uint32(len(b.rows)))
+	binary.LittleEndian.PutUint32(header[92:], uint32(colCount))
+	binary.LittleEndian.PutUint64(header[96:], matchersOffset)
+	binary.LittleEndian.PutUint32(header[104:], uint32(len(matchers)))
+	_, err := file.WriteAt(header, 0)
+	return err
+}
+
+// --- 読み込み ---
+
+// snapshot は mmap したスナップショットファイルです。
+type snapshot struct {
+	data     []byte
+	unmap    func() error
+	source   snapshotSource
+	matchers []snapshotMatcher
+
+	stringCount   uint64
+	stringOffsets []byte
+	stringData    []byte
+
+	rowCount uint32
+	colCount uint32
+	columns  []string
+	cells    []byte
+}
+
+// snapshotMatcher はスナップショットに含まれる matcher とその索引です。
+type snapshotMatcher struct {
+	lookupField   string
+	method        string
+	caseSensitive bool
+	kind          uint32
+	index         []byte
+}
+
+// openSnapshot はスナップショットを mmap し、各セクションの範囲を検証します。
+func openSnapshot(path string) (*snapshot, error) {
+	data, unmap, err := mmapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := parseSnapshot(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	s.unmap = unmap
+	return s, nil
+}
+
+func parseSnapshot(data []byte) (*snapshot, error) {
+	if len(data) < snapshotHeaderSize || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("not a lookup-go snapshot")
+	}
+	section := func(offset, length uint64) ([]byte, error) {
+		if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return nil, fmt.Errorf("section out of range")
+		}
+		return data[offset : offset+length], nil
+	}
+
+	s := &snapshot{data: data}
+	copy(s.source.Checksum[:], data[16:48])
+	s.source.Size = int64(binary.LittleEndian.Uint64(data[48:]))
+	s.source.ModTime = int64(binary.LittleEndian.Uint64(data[56:]))
+
+	stringsOffset := binary.LittleEndian.Uint64(data[64:])
+	s.stringCount = binary.LittleEndian.Uint64(data[72:])
+	if s.stringCount >= uint64(len(data))/8 {
+		return nil, fmt.Errorf("string table out of range")
+	}
+	var err error
+	if s.stringOffsets, err = section(stringsOffset, (s.stringCount+1)*8); err != nil {
+		return nil, err
+	}
+	blobLen := binary.LittleEndian.Uint64(s.stringOffsets[s.stringCount*8:])
+	if s.stringData, err = section(stringsOffset+(s.stringCount+1)*8, blobLen); err != nil {
+		return nil, err
+	}
+
+	rowsOffset := binary.LittleEndian.Uint64(data[80:])
+	s.rowCount = binary.LittleEndian.Uint32(data[88:])
+	s.colCount = binary.LittleEndian.Uint32(data[92:])
+	columnIDs, err := section(rowsOffset, uint64(s.colCount)*4)
+	if err != nil {
+		return nil, err
+	}
+	if s.cells, err = section(rowsOffset+uint64(s.colCount)*4, uint64(s.rowCount)*uint64(s.colCount)*4); err != nil {
+		return nil, err
+	}
+	s.columns = make([]string, s.colCount)
+	for i := range s.columns {
+		if s.columns[i], err = s.str(binary.LittleEndian.Uint32(columnIDs[i*4:])); err != nil {
+			return nil, err
+		}
+	}
+
+	matchersOffset := binary.LittleEndian.Uint64(data[96:])
+	matcherCount := binary.LittleEndian.Uint32(data[104:])
+	table, err := section(matchersOffset, uint64(matcherCount)*snapshotMatcherEntrySize)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < matcherCount; i++ {
+		entry := table[i*snapshotMatcherEntrySize:]
+		var m snapshotMatcher
+		if m.lookupField, err = s.str(binary.LittleEndian.Uint32(entry)); err != nil {
+			return nil, err
+		}
+		if m.method, err = s.str(binary.LittleEndian.Uint32(entry[4:])); err != nil {
+			return nil, err
+		}
+		m.caseSensitive = binary.LittleEndian.Uint32(entry[8:]) == 1
+		m.kind = binary.LittleEndian.Uint32(entry[12:])
+		if m.index, err = section(binary.LittleEndian.Uint64(entry[16:]), binary.LittleEndian.Uint64(entry[24:])); err != nil {
+			return nil, err
+		}
+		s.matchers = append(s.matchers, m)
+	}
+	return s, nil
+}
+
+// str は文字列IDに対応する文字列を返します。
+func (s *snapshot) str(id uint32) (string, error) {
+	if uint64(id) >= s.stringCount {
+		return "", fmt.Errorf("string id %d out of range", id)
+	}
+	start := binary.LittleEndian.Uint64(s.stringOffsets[uint64(id)*8:])
+	end := binary.LittleEndian.Uint64(s.stringOffsets[uint64(id)*8+8:])
+	if start > end || end > uint64(len(s.stringData)) {
+		return "", fmt.Errorf("string id %d out of range", id)
+	}
+	return string(s.stringData[start:end]), nil
+}
+
+// row は行番号に対応する行を復元します。
+func (s *snapshot) row(r uint32) (map[string]string, error) {
+	if r >= s.rowCount {
+		return nil, fmt.Errorf("row %d out of range", r)
+	}
+	row := make(map[string]string, s.colCount)
+	base := uint64(r) * uint64(s.colCount) * 4
+	for col := uint32(0); col < s.colCount; col++ {
+		id := binary.LittleEndian.Uint32(s.cells[base+uint64(col)*4:])
+		if id == snapshotNoValue {
+			continue
+		}
+		value, err := s.str(id)
+		if err != nil {
+			return nil, err
+		}
+		row[s.columns[col]] = value
+	}
+	return row, nil
+}
+
+// findMatcher は lookup_field、method、case_sensitive が一致する索引を探します。
+func (s *snapshot) findMatcher(matcher *Matcher) *snapshotMatcher {
+	for i := range s.matchers {
+		m := &s.matchers[i]
+		if m.lookupField == matcher.LookupField && m.method == matcher.Method && m.caseSensitive == matcher.CaseSensitive {
+			return m
+		}
+	}
+	return nil
+}
+
+// Close はメモリマップを解除します。
+func (s *snapshot) Close() error {
+	if s.unmap == nil {
+		return nil
+	}
+	return s.unmap()
+}
+
+// checkFresh はデータソースがスナップショットの生成時から変更されていないかを確認します。
+// サイズと更新時刻が一致すればハッシュの計算を省略します。
+func (s *snapshot) checkFresh(sourcePath string) error {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return fmt.Errorf("could not stat data source: %w", err)
+	}
+	if info.Size() == s.source.Size && info.ModTime().UnixNano() == s.source.ModTime {
+		return nil
+	}
+	if info.Size() != s.source.Size {
+		return fmt.Errorf("data source size changed")
+	}
+	sum, err := sha256File(sourcePath)
+	if err != nil {
+		return fmt.Errorf("could not read data source: %w", err)
+	}
+	if sum != s.source.Checksum {
+		return fmt.Errorf("data source checksum changed")
+	}
+	return nil
+}
+
+// --- ルックアップ ---
+
+// snapshotLookuper はスナップショットの索引を用いてマッチングを行います。
+// 結果は findMatch と同じく、データソースで最初に一致した行です。
+type snapshotLookuper struct {
+	snap     *snapshot
+	index    *snapshotMatcher
+	matcher  *Matcher
+	patterns []*regexp.Regexp
+
+	cidr4, cidr6 []byte // CIDR索引の IPv4 と IPv6 のエントリ (件数は検証済み)
+}
+
+// newSnapshotLookuper はスナップショットから matcher に対応する索引を取り出します。
+func newSnapshotLookuper(snap *snapshot, matcher *Matcher) (*snapshotLookuper, error) {
+	index := snap.findMatcher(matcher)
+	if index == nil {
+		return nil, fmt.Errorf("snapshot has no index for lookup_field='%s' (method: %s, case_sensitive: %t)", matcher.LookupField, matcher.Method, matcher.CaseSensitive)
+	}
+	l := &snapshotLookuper{snap: snap, index: index, matcher: matcher}
+	if index.kind == snapshotIndexCIDR {
+		var err error
+		if l.cidr4, l.cidr6, err = cidrEntries(index.index); err != nil {
+			return nil, err
+		}
+	}
+	if matcher.Method == "regex" {
+		count, err := patternCount(index.index)
+		if err != nil {
+			return nil, err
+		}
+		l.patterns = make([]*regexp.Regexp, count)
+		for i := range l.patterns {
+			pattern, err := snap.str(binary.LittleEndian.Uint32(index.index[8+i*snapshotPatternEntrySize:]))
+			if err != nil {
+				return nil, err
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				log.Printf("Warning: Error during match (method: regex, pattern: %s): %v", pattern, err)
+				continue
+			}
+			l.patterns[i] = re
+		}
+	}
+	return l, nil
+}
+
+// Lookup は索引の種類に応じて一致する行を探します。
+func (l *snapshotLookuper) Lookup(value string) (map[string]string, error) {
+	row, found, err := l.lookupRow(normalizeLookupValue(value, l.matcher))
+	if err != nil || !found {
+		return nil, err
+	}
+	return l.snap.row(row)
+}
+
+// Explain は索引を引いた結果を説明します。
+func (l *snapshotLookuper) Explain(value string) (map[string]string, *lookupExplanation, error) {
+	normalized := normalizeLookupValue(value, l.matcher)
+	ex := (&lookupExplanation{Source: "snapshot", NormalizedValue: normalized}).withMatcher(l.matcher)
+	switch l.index.kind {
+	case snapshotIndexExact:
+		ex.Index = "hash"
+	case snapshotIndexCIDR:
+		ex.Index = "cidr ranges"
+	case snapshotIndexPattern:
+		ex.Index = "patterns"
+	}
+	rowIndex, found, err := l.lookupRow(normalized)
+	if err != nil {
+		return nil, ex, err
+	}
+	if !found {
+		reason := "key not found in index"
+		if l.index.kind == snapshotIndexCIDR && net.ParseIP(normalized) == nil {
+			reason = "input value is not an IP address"
+		}
+		ex.finish(false, reason)
+		return nil, ex, nil
+	}
+	row, err := l.snap.row(rowIndex)
+	if err != nil {
+		return nil, ex, err
+	}
+	ex.MatchedRow = int(rowIndex) + 1
+	ex.MatchedValue = row[l.matcher.LookupField]
+	ex.finish(true, "")
+	return row, ex, nil
+}
+
+// lookupRow は正規化した値に一致する行の位置を返します。
+func (l *snapshotLookuper) lookupRow(value string) (uint32, bool, error) {
+	switch l.index.kind {
+	case snapshotIndexExact:
+		return l.lookupExact(value)
+	case snapshotIndexCIDR:
+		row, found := l.lookupCIDR(value)
+		return row, found, nil
+	case snapshotIndexPattern:
+		return l.lookupPattern(value)
+	default:
+		return 0, false, fmt.Errorf("unknown snapshot index kind %d", l.index.kind)
+	}
+}
+
+func (l *snapshotLookuper) lookupExact(key string) (uint32, bool, error) {
+	index := l.index.index
+	if len(index) < 8 {
+		return 0, false, fmt.Errorf("corrupt exact index")
+	}
+	slotCount := binary.LittleEndian.Uint64(index)
+	table := index[8:]
+	if slotCount == 0 || slotCount > uint64(len(table)/snapshotExactSlotSize) {
+		return 0, false, fmt.Errorf("corrupt exact index")
+	}
+	h := snapshotHash(key)
+	for i, probes := h&(slotCount-1), uint64(0); probes < slotCount; i, probes = (i+1)&(slotCount-1), probes+1 {
+		slot := table[i*snapshotExactSlotSize:]
+		row := binary.LittleEndian.Uint32(slot[12:])
+		if row == snapshotNoValue {
+			return 0, false, nil
+		}
+		if binary.LittleEndian.Uint64(slot) != h {
+			continue
+		}
+		stored, err := l.snap.str(binary.LittleEndian.Uint32(slot[8:]))
+		if err != nil {
+			return 0, false, err
+		}
+		if stored == key {
+			return row, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// lookupCIDR は開始アドレスが ip 以下の最後の範囲から親をたどり、
+// ip を包含する範囲のうち最も小さい行番号を返します。
+func (l *snapshotLookuper) lookupCIDR(value string) (uint32, bool) {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return 0, false
+	}
+	var entries []byte
+	var addrLen, entrySize int
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, entries, addrLen, entrySize = ip4, l.cidr4, net.IPv4len, snapshotCIDR4EntrySize
+	} else {
+		entries, addrLen, entrySize = l.cidr6, net.IPv6len, snapshotCIDR6EntrySize
+	}
+	count := len(entries) / entrySize
+	entry := func(i int) []byte { return entries[i*entrySize:] }
+
+	i := sort.Search(count, func(i int) bool {
+		return bytes.Compare(entry(i)[:addrLen], ip) > 0
+	}) - 1
+
+	best, found := uint32(0), false
+	for steps := 0; i >= 0 && i < count && steps <= 8*addrLen; steps++ {
+		e := entry(i)
+		if bytes.Compare(e[addrLen:2*addrLen], ip) >= 0 {
+			row := binary.LittleEndian.Uint32(e[2*addrLen:])
+			if !found || row < best {
+				best, found = row, true
+			}
+		}
+		i = int(int32(binary.LittleEndian.Uint32(e[2*addrLen+4:])))
+	}
+	return best, found
+}
+
+func (l *snapshotLookuper) lookupPattern(value string) (uint32, bool, error) {
+	index := l.index.index
+	count, err := patternCount(index)
+	if err != nil {
+		return 0, false, err
+	}
+	for i := 0; i < count; i++ {
+		entry := index[8+i*snapshotPatternEntrySize:]
+		row := binary.LittleEndian.Uint32(entry[4:])
+		if l.matcher.Method == "regex" {
+			if l.patterns[i] != nil && l.patterns[i].MatchString(value) {
+				return row, true, nil
+			}
+			continue
+		}
+		pattern, err := l.snap.str(binary.LittleEndian.Uint32(entry))
+		if err != nil {
+			return 0, false, err
+		}
+		matched, err := filepath.Match(pattern, value)
+		if err != nil {
+			log.Printf("Warning: Error during match (method: %s, pattern: %s): %v", l.matcher.Method, pattern, err)
+			continue
+		}
+		if matched {
+			return row, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// cidrEntries はCIDR索引を IPv4 と IPv6 のエントリに分けます。
+// patternCount と同じく、件数を索引の長さで確かめてから切り出すため、壊れた件数で範囲外を参照することはありません。
+func cidrEntries(index []byte) (v4, v6 []byte, err error) {
+	if len(index) < 8 {
+		return nil, nil, fmt.Errorf("corrupt cidr index")
+	}
+	v4Count := binary.LittleEndian.Uint64(index)
+	if v4Count > uint64((len(index)-8)/snapshotCIDR4EntrySize) {
+		return nil, nil, fmt.Errorf("corrupt cidr index")
+	}
+	v4End := 8 + int(v4Count)*snapshotCIDR4EntrySize
+	rest := index[v4End:]
+	if len(rest) < 8 {
+		return nil, nil, fmt.Errorf("corrupt cidr index")
+	}
+	v6Count := binary.LittleEndian.Uint64(rest)
+	if v6Count > uint64((len(rest)-8)/snapshotCIDR6EntrySize) {
+		return nil, nil, fmt.Errorf("corrupt cidr index")
+	}
+	return index[8:v4End], rest[8 : 8+int(v6Count)*snapshotCIDR6EntrySize], nil
+}
+
+// patternCount はパターンの索引の件数を返します。
+// スナップショットが壊れている場合に、索引の長さを超えて読んだり、巨大なスライスを確保したりしないよう、件数を索引の長さで確かめます。
+func patternCount(index []byte) (int, error) {
+	if len(index) < 8 {
+		return 0, fmt.Errorf("corrupt pattern index")
+	}
+	count := binary.LittleEndian.Uint64(index)
+	if count > uint64((len(index)-8)/snapshotPatternEntrySize) {
+		return 0, fmt.Errorf("corrupt pattern index")
+	}
+	return int(count), nil
+}
+
+// Close はスナップショットのメモリマップを解除します。
+func (l *snapshotLookuper) Close() error {
+	return l.snap.Close()
+}
+
+// loadSnapshotLookuper は設定の snapshot を開き、データソースと matcher に対して有効であれば
+// snapshotLookuper を返します。古い場合はエラーを返し、呼び出し側はデータソースを直接読み込みます。
+func loadSnapshotLookuper(snapshotPath, sourcePath string, matcher *Matcher) (*snapshotLookuper, error) {
+	snap, err := openSnapshot(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := snap.checkFresh(sourcePath); err != nil {
+		snap.Close()
+		return nil, fmt.Errorf("snapshot %s is stale: %w", snapshotPath, err)
+	}
+	lookuper, err := newSnapshotLookuper(snap, matcher)
+	if err != nil {
+		snap.Close()
+		return nil, err
+	}
+	return lookuper, nil
+}
+
+// --- build-snapshot サブコマンド ---
+
+// handleBuildSnapshot は build-snapshot サブコマンドの引数を処理し、実行します。
+func handleBuildSnapshot() {
+	cmd := flag.NewFlagSet("build-snapshot", flag.ExitOnError)
+	configPath := cmd.String("c", "", "Path to the lookup configuration file.")
+	outPath := cmd.String("o", "", "Path of the snapshot file to create. Defaults to the 'snapshot' setting of the config.")
+	cmd.Parse(os.Args[2:])
+
+	if *configPath == "" {
+		log.Fatal("Error: -c flag is required for build-snapshot command.")
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Error loading config file: %v", err)
+	}
+	if config.Type != "" && config.Type != "file" {
+		log.Fatalf("Error: build-snapshot requires a file data source, but the config has type '%s'", config.Type)
+	}
+
+	output := *outPath
+	if output == "" {
+		if config.Snapshot == "" {
+			log.Fatal("Error: -o flag is required when the config has no 'snapshot' setting.")
+		}
+		output = resolveDataSourcePath(*configPath, config.Snapshot)
+	}
+
+	sourcePath, err := resolveConfiguredDataSource(*configPath, config)
+	if err != nil {
+		log.Fatalf("Error loading data source: %v", err)
+	}
+	if isMultiFileSource(sourcePath) {
+		log.Fatal("Error: build-snapshot does not support directory or glob data sources.")
+	}
+
+	start := time.Now()
+	if err := buildSnapshot(sourcePath, config.Matchers, output); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Printf("Wrote snapshot of %s with %d matcher(s) to %s in %s", filepath.Base(sourcePath), len(config.Matchers), output, time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const snapshotTestCSV = `name,network,pattern
+Alpha,10.1.0.0/16,web-*
+Beta,10.0.0.0/8,^DB-[0-9]+$
+Gamma,10.1.2.0/24,*
+alpha,192.168.0.0/16,[invalid
+Delta,2001:db8::/32,mail?
+Epsilon,not-a-cidr,
+`
+
+func TestSnapshotMatchesFindMatch(t *testing.T) {
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "table.csv")
+	if err := os.WriteFile(sourcePath, []byte(snapshotTestCSV), 0600); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+	matchers := []Matcher{
+		{LookupField: "name", Method: "exact"},
+		{LookupField: "name", Method: "exact", CaseSensitive: true},
+		{LookupField: "network", Method: "cidr"},
+		{LookupField: "pattern", Method: "wildcard"},
+		{LookupField: "pattern", Method: "regex"},
+	}
+	snapshotPath := filepath.Join(dir, "table.snap")
+	if err := buildSnapshot(sourcePath, matchers, snapshotPath); err != nil {
+		t.Fatalf("buildSnapshot failed: %v", err)
+	}
+
+	data, err := loadLookupData(sourcePath)
+	if err != nil {
+		t.Fatalf("loadLookupData failed: %v", err)
+	}
+	values := []string{
+		"alpha", "ALPHA", "Alpha", "beta", "unknown", "",
+		"10.1.2.3", "10.1.9.9", "10.200.0.1", "192.168.1.1", "172.16.0.1",
+		"2001:db8::1", "2001:db9::1", "::ffff:10.1.2.3", "not-an-ip",
+		"web-01", "db-42", "DB-42", "mail1", "anything",
+	}
+
+	for i := range matchers {
+		matcher := &matchers[i]
+		lookuper, err := loadSnapshotLookuper(snapshotPath, sourcePath, matcher)
+		if err != nil {
+			t.Fatalf("loadSnapshotLookuper failed for %+v: %v", matcher, err)
+		}
+		for _, value := range values {
+			expected := findMatch(value, data, matcher)
+			actual, err := lookuper.Lookup(value)
+			if err != nil {
+				t.Fatalf("Lookup(%q) failed for %+v: %v", value, matcher, err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("Lookup(%q) with %+v: expected %v, but got %v", value, matcher, expected, actual)
+			}
+		}
+		lookuper.Close()
+	}
+}
+
+func TestSnapshotStaleness(t *testing.T) {
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "table.csv")
+	if err := os.WriteFile(sourcePath, []byte(snapshotTestCSV), 0600); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+	matcher := Matcher{LookupField: "name", Method: "exact"}
+	snapshotPath := filepath.Join(dir, "table.snap")
+	if err := buildSnapshot(sourcePath, []Matcher{matcher}, snapshotPath); err != nil {
+		t.Fatalf("buildSnapshot failed: %v", err)
+	}
+
+	// Touching the source without changing it keeps the snapshot valid.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(sourcePath, later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	lookuper, err := loadSnapshotLookuper(snapshotPath, sourcePath, &matcher)
+	if err != nil {
+		t.Fatalf("Expected snapshot to be fresh after touch, got: %v", err)
+	}
+	lookuper.Close()
+
+	// A matcher that was not compiled into the snapshot is rejected.
+	if _, err := loadSnapshotLookuper(snapshotPath, sourcePath, &Matcher{LookupField: "network", Method: "cidr"}); err == nil {
+		t.Error("Expected an error for a matcher missing from the snapshot, but got nil")
+	}
+
+	// Changing the content makes the snapshot stale.
+	if err := os.WriteFile(sourcePath, []byte(snapshotTestCSV+"Zeta,,\n"), 0600); err != nil {
+		t.Fatalf("Failed to update source: %v", err)
+	}
+	if _, err := loadSnapshotLookuper(snapshotPath, sourcePath, &matcher); err == nil {
+		t.Error("Expected a stale snapshot error, but got nil")
+	}
+}
+
+func TestSnapshotCorruptPatternIndex(t *testing.T) {
+	huge := make([]byte, 16)
+	binary.LittleEndian.PutUint64(huge, 1<<62)
+	for _, index := range [][]byte{nil, {1, 2, 3}, huge} {
+		snap := &snapshot{matchers: []snapshotMatcher{
+			{lookupField: "pattern", method: "regex", index: index},
+			{lookupField: "pattern", method: "wildcard", index: index},
+		}}
+		// A truncated or corrupt index is an error, so the caller falls back to the data source.
+		if _, err := newSnapshotLookuper(snap, &Matcher{LookupField: "pattern", Method: "regex"}); err == nil {
+			t.Errorf("Expected an error for the regex index %v, but got nil", index)
+		}
+		lookuper, err := newSnapshotLookuper(snap, &Matcher{LookupField: "pattern", Method: "wildcard"})
+		if err != nil {
+			t.Fatalf("newSnapshotLookuper failed: %v", err)
+		}
+		if _, _, err := lookuper.lookupPattern("web-01"); err == nil {
+			t.Errorf("Expected an error for the wildcard index %v, but got nil", index)
+		}
+	}
+}
+
+func TestSnapshotCorruptCIDRIndex(t *testing.T) {
+	// A count that overflows when multiplied by the entry size must not pass the length check.
+	hugeV4 := make([]byte, 32)
+	binary.LittleEndian.PutUint64(hugeV4, 1<<60)
+	hugeV6 := make([]byte, 24)
+	binary.LittleEndian.PutUint64(hugeV6[8:], 1<<60)
+	noV6Count := make([]byte, 8+snapshotCIDR4EntrySize)
+	binary.LittleEndian.PutUint64(noV6Count, 1)
+	for _, index := range [][]byte{nil, {1, 2, 3}, hugeV4, hugeV6, noV6Count} {
+		snap := &snapshot{matchers: []snapshotMatcher{{lookupField: "network", method: "cidr", kind: snapshotIndexCIDR, index: index}}}
+		if _, err := newSnapshotLookuper(snap, &Matcher{LookupField: "network", Method: "cidr"}); err == nil {
+			t.Errorf("Expected an error for the cidr index %v, but got nil", index)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// --- 実行統計 (--stats) ---
+
+// runStats は1回の実行で処理したレコードの件数と、各段階の所要時間を集計します。
+// メソッドは nil のレシーバでも呼び出せるため、--stats が無効な場合は nil のまま渡します。
+type runStats struct {
+	mapping string
+
+	mu sync.Mutex // 並列に処理する入力 (--parallel) からの集計を保護する
+
+	recordsRead int
+	invalidJSON int
+	matched     int
+	unmatched   int
+	skipped     int // 入力フィールドがない、または文字列ではない
+	errors      int
+	filtered    int // --where で出力しなかったレコード
+	dropped     int // --on-error で出力しなかったレコード
+
+	last   time.Time
+	phases map[string]time.Duration
+
+	cacheHits, cacheMisses int64
+	hasCache               bool
+}
+
+// 計測する段階の名前です。
+const (
+	phaseLoad    = "load"    // 設定とデータソースの読み込み
+	phaseIndex   = "index"   // ルックアップ用の索引の構築
+	phaseProcess = "process" // 入力の処理
+)
+
+// cacheStatsReporter はキャッシュを持つ Lookuper が実装します。
+// ok が false の場合はキャッシュを使用していません。
+type cacheStatsReporter interface {
+	cacheStats() (hits, misses int64, ok bool)
+}
+
+// newRunStats は集計を開始します。段階の計測は呼び出した時点から始まります。
+func newRunStats(mapping string) *runStats {
+	return &runStats{mapping: mapping, last: time.Now(), phases: make(map[string]time.Duration)}
+}
+
+// lap は前回の lap (または集計の開始) からの経過時間を phase の所要時間に加えます。
+func (s *runStats) lap(phase string) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	s.phases[phase] += now.Sub(s.last)
+	s.last = now
+}
+
+// read は入力のレコードを1件読み込んだことを記録します。valid はJSONとして解釈できたかどうかです。
+func (s *runStats) read(valid bool) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordsRead++
+	if !valid {
+		s.invalidJSON++
+	}
+}
+
+// record はレコードのルックアップ結果 (explainMatched など) を集計します。
+func (s *runStats) record(result string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch result {
+	case explainMatched:
+		s.matched++
+	case explainNoMatch:
+		s.unmatched++
+	case explainSkipped:
+		s.skipped++
+	case explainError:
+		s.errors++
+	}
+}
+
+// filter は --where の条件でレコードを出力しなかったことを記録します。
+func (s *runStats) filter() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filtered++
+}
+
+// drop は --on-error で失敗したレコードを出力しなかったことを記録します。
+func (s *runStats) drop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped++
+}
+
+// collectCache は lookuper がキャッシュを持っていれば、そのヒット数とミス数を記録します。
+func (s *runStats) collectCache(lookuper Lookuper) {
+	if s == nil {
+		return
+	}
+	if reporter, ok := lookuper.(cacheStatsReporter); ok {
+		s.cacheHits, s.cacheMisses, s.hasCache = reporter.cacheStats()
+	}
+}
+
+// processed はJSONとして解釈でき、ルックアップを試みたレコードの件数です。
+func (s *runStats) processed() int {
+	return s.matched + s.unmatched + s.skipped + s.errors
+}
+
+func ratio(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// statsReport は --stats=json で出力する統計です。
+type statsReport struct {
+	RecordsRead   int                `json:"records_read"`
+	InvalidJSON   int                `json:"invalid_json"`
+	Matched       int                `json:"matched"`
+	Unmatched     int                `json:"unmatched"`
+	Skipped       int                `json:"skipped"`
+	Errors        int                `json:"errors"`
+	Filtered      int                `json:"filtered"`
+	Dropped       int                `json:"dropped"`
+	Mappings      []mappingReport    `json:"mappings"`
+	Cache         *cacheReport       `json:"cache,omitempty"`
+	Throughput    float64            `json:"records_per_second"`
+	PhasesSeconds map[string]float64 `json:"phases_seconds"`
+}
+
+type mappingReport struct {
+	Mapping   string  `json:"mapping"`
+	Matched   int     `json:"matched"`
+	Unmatched int     `json:"unmatched"`
+	Skipped   int     `json:"skipped"`
+	Errors    int     `json:"errors"`
+	MatchRate float64 `json:"match_rate"`
+}
+
+type cacheReport struct {
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// report は集計結果を出力用の構造にまとめます。
+func (s *runStats) report() *statsReport {
+	r := &statsReport{
+		RecordsRead: s.recordsRead,
+		InvalidJSON: s.invalidJSON,
+		Matched:     s.matched,
+		Unmatched:   s.unmatched,
+		Skipped:     s.skipped,
+		Errors:      s.errors,
+		Filtered:    s.filtered,
+		Dropped:     s.dropped,
+		Mappings: []mappingReport{{
+			Mapping:   s.mapping,
+			Matched:   s.matched,
+			Unmatched: s.unmatched,
+			Skipped:   s.skipped,
+			Errors:    s.errors,
+			MatchRate: ratio(int64(s.matched), int64(s.processed())),
+		}},
+		PhasesSeconds: make(map[string]float64, len(s.phases)),
+	}
+	if s.hasCache {
+		r.Cache = &cacheReport{Hits: s.cacheHits, Misses: s.cacheMisses, HitRatio: ratio(s.cacheHits, s.cacheHits+s.cacheMisses)}
+	}
+	for _, phase := range []string{phaseLoad, phaseIndex, phaseProcess} {
+		r.PhasesSeconds[phase] = s.phases[phase].Seconds()
+	}
+	if seconds := s.phases[phaseProcess].Seconds(); seconds > 0 {
+		r.Throughput = float64(s.recordsRead) / seconds
+	}
+	return r
+}
+
+// write は統計を format ("text" または "json") で出力します。
+func (s *runStats) write(w io.Writer, format string) error {
+	r := s.report()
+	if format == "json" {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Records read:\t%d\n", r.RecordsRead)
+	fmt.Fprintf(tw, "Invalid JSON:\t%d\n", r.InvalidJSON)
+	fmt.Fprintf(tw, "Matched:\t%d\n", r.Matched)
+	fmt.Fprintf(tw, "Unmatched:\t%d\n", r.Unmatched)
+	fmt.Fprintf(tw, "Skipped:\t%d\t(input field missing or not a string)\n", r.Skipped)
+	fmt.Fprintf(tw, "Errors:\t%d\n", r.Errors)
+	if r.Filtered > 0 {
+		fmt.Fprintf(tw, "Filtered:\t%d\t(removed by --where)\n", r.Filtered)
+	}
+	if r.Dropped > 0 {
+		fmt.Fprintf(tw, "Dropped:\t%d\t(failed records removed by --on-error)\n", r.Dropped)
+	}
+	for _, m := range r.Mappings {
+		fmt.Fprintf(tw, "Match rate:\t%.1f%%\t(%s)\n", m.MatchRate*100, m.Mapping)
+	}
+	if r.Cache != nil {
+		fmt.Fprintf(tw, "Cache hit ratio:\t%.1f%%\t(%d hits, %d misses)\n", r.Cache.HitRatio*100, r.Cache.Hits, r.Cache.Misses)
+	}
+	fmt.Fprintf(tw, "Throughput:\t%.1f records/s\n", r.Throughput)
+	fmt.Fprintf(tw, "Time:\tload %s, index %s, process %s\n",
+		s.phases[phaseLoad].Round(time.Microsecond), s.phases[phaseIndex].Round(time.Microsecond), s.phases[phaseProcess].Round(time.Microsecond))
+	return tw.Flush()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunStatsCounts(t *testing.T) {
+	matcher := &Matcher{InputField: "user", LookupField: "name", Method: "exact"}
+	lookuper := &tableLookuper{data: LookupData{{"name": "alice"}}, matcher: matcher}
+	mapping := &Mapping{InputField: "user", LookupField: "name"}
+	stats := newRunStats("user as name")
+	processor := &recordProcessor{mapping: mapping, lookuper: lookuper, stats: stats}
+
+	records := []map[string]interface{}{
+		{"user": "alice"},
+		{"user": "ALICE"},
+		{"user": "bob"},
+		{"user": 1.0},
+		{"other": "alice"},
+	}
+	stats.read(false)
+	for _, record := range records {
+		stats.read(true)
+		processor.processObject(record)
+	}
+	stats.lap(phaseProcess)
+
+	r := stats.report()
+	if r.RecordsRead != 6 || r.InvalidJSON != 1 || r.Matched != 2 || r.Unmatched != 1 || r.Skipped != 2 || r.Errors != 0 {
+		t.Errorf("Unexpected counts: %+v", r)
+	}
+	if len(r.Mappings) != 1 || r.Mappings[0].Mapping != "user as name" || r.Mappings[0].MatchRate != 0.4 {
+		t.Errorf("Unexpected mapping report: %+v", r.Mappings)
+	}
+	if r.Cache != nil {
+		t.Errorf("Expected no cache report for a table lookup, but got %+v", r.Cache)
+	}
+	for _, phase := range []string{phaseLoad, phaseIndex, phaseProcess} {
+		if _, ok := r.PhasesSeconds[phase]; !ok {
+			t.Errorf("Expected phase %q in %v", phase, r.PhasesSeconds)
+		}
+	}
+}
+
+func TestRunStatsWrite(t *testing.T) {
+	stats := newRunStats("ip as network")
+	stats.read(true)
+	stats.read(true)
+	stats.read(false)
+	stats.record(explainMatched)
+	stats.record(explainError)
+	stats.phases[phaseProcess] = 2 * time.Second
+	stats.cacheHits, stats.cacheMisses, stats.hasCache = 3, 1, true
+
+	var text bytes.Buffer
+	if err := stats.write(&text, "text"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	for _, want := range []string{"Records read:     3", "Match rate:       50.0%  (ip as network)", "Cache hit ratio:  75.0%  (3 hits, 1 misses)", "Throughput:       1.5 records/s"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("Expected text output to contain %q, but got:\n%s", want, text.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := stats.write(&out, "json"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	var report statsReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("Could not parse JSON stats %q: %v", out.String(), err)
+	}
+	if report.Errors != 1 || report.Cache == nil || report.Cache.HitRatio != 0.75 || report.PhasesSeconds[phaseProcess] != 2 {
+		t.Errorf("Unexpected JSON report: %s", out.String())
+	}
+}
+
+func TestRunStatsNil(t *testing.T) {
+	var stats *runStats
+	// All recording methods must be no-ops when --stats is disabled.
+	stats.lap(phaseLoad)
+	stats.read(true)
+	stats.record(explainMatched)
+	stats.collectCache(&tableLookuper{})
+}
+
+func TestLookupCacheStats(t *testing.T) {
+	cache := newLookupCache(10, time.Minute)
+	cache.get("a")
+	cache.put("a", nil)
+	cache.get("a")
+	cache.get("a")
+	if hits, misses := cache.stats(); hits != 2 || misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, but got %d hits and %d misses", hits, misses)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "net/url"
+
+// --- 一致状況のフィールド (--status-field) ---
+
+// matchStatus はレコードに書き込む一致状況です。
+// 「一致しなかった」と「値が空の行に一致した」を出力先で区別できるようにします。
+type matchStatus struct {
+	Matched        bool   `json:"matched"`
+	MatchCount     int    `json:"match_count"`
+	MatchedPattern string `json:"matched_pattern,omitempty"` // 一致した行の lookup_field の値 (キーやパターン)
+	Source         string `json:"source,omitempty"`
+}
+
+// newMatchStatus は一致した行 (一致しなかった場合は nil) から一致状況を作ります。
+// matched_pattern と source は最初に一致した行のものです。
+// 行に _source_file があれば (複数ファイルのデータソース)、データソース名の代わりにそのファイル名を記録します。
+func newMatchStatus(rows []map[string]string, lookupField, sourceName string) *matchStatus {
+	status := &matchStatus{Source: sourceName}
+	if len(rows) == 0 {
+		return status
+	}
+	row := rows[0]
+	status.Matched = true
+	status.MatchCount = len(rows)
+	status.MatchedPattern = row[lookupField]
+	if file, ok := row[sourceFileField]; ok && file != "" {
+		status.Source = file
+	}
+	return status
+}
+
+// dataSourceName は一致状況の source に記録する、設定のデータソース名です。
+// http の場合は、URLのパスやクエリに含まれる認証情報を記録しないよう、スキームとホストのみとします。
+// リモートの data_source なども、環境変数の展開で埋め込まれた認証情報 (ユーザー情報やクエリ) を除きます。
+func dataSourceName(config *Config) string {
+	if config.Type == "http" && config.HTTP != nil {
+		u, err := url.Parse(config.HTTP.URL)
+		if err != nil {
+			return "http"
+		}
+		return u.Scheme + "://" + u.Host
+	}
+	return redactURL(config.DataSource)
+}
+
+// redactURL は URL の形のデータソース名からユーザー情報、クエリ、フラグメントを除きます。
+// URL でなければ (ファイルのパスなど) そのまま返します。
+func redactURL(source string) string {
+	u, err := url.Parse(source)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return source
+	}
+	u.User, u.RawQuery, u.ForceQuery, u.Fragment, u.RawFragment = nil, "", false, "", ""
+	return u.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewMatchStatus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rows     []map[string]string
+		expected matchStatus
+	}{
+		{name: "No match", rows: nil, expected: matchStatus{Source: "./iocs.csv"}},
+		{
+			name:     "Match with empty values",
+			rows:     []map[string]string{{"network": "10.0.0.0/8", "threat": ""}},
+			expected: matchStatus{Matched: true, MatchCount: 1, MatchedPattern: "10.0.0.0/8", Source: "./iocs.csv"},
+		},
+		{
+			name:     "Row from a multi-file source",
+			rows:     []map[string]string{{"network": "10.0.0.0/8", sourceFileField: "feeds/a.csv"}},
+			expected: matchStatus{Matched: true, MatchCount: 1, MatchedPattern: "10.0.0.0/8", Source: "feeds/a.csv"},
+		},
+		{
+			name:     "Multiple rows",
+			rows:     []map[string]string{{"network": "10.1.0.0/16"}, {"network": "10.0.0.0/8"}},
+			expected: matchStatus{Matched: true, MatchCount: 2, MatchedPattern: "10.1.0.0/16", Source: "./iocs.csv"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := newMatchStatus(tc.rows, "network", "./iocs.csv")
+			if !reflect.DeepEqual(*got, tc.expected) {
+				t.Errorf("Expected %+v, but got %+v", tc.expected, *got)
+			}
+		})
+	}
+}
+
+func TestDataSourceName(t *testing.T) {
+	testCases := []struct {
+		config   Config
+		expected string
+	}{
+		{config: Config{DataSource: "./users.csv"}, expected: "./users.csv"},
+		{config: Config{Type: "mmdb", DataSource: "GeoLite2-City.mmdb"}, expected: "GeoLite2-City.mmdb"},
+		{config: Config{Type: "http", HTTP: &HTTPSourceConfig{URL: "https://cmdb.example.com/api/{value}?token=secret"}}, expected: "https://cmdb.example.com"},
+		{config: Config{DataSource: "https://u:p@host/x.csv?token=abc"}, expected: "https://host/x.csv"},
+		{config: Config{DataSource: "https://host/x.csv#frag"}, expected: "https://host/x.csv"},
+	}
+	for _, tc := range testCases {
+		if got := dataSourceName(&tc.config); got != tc.expected {
+			t.Errorf("dataSourceName(%+v): expected %q, but got %q", tc.config, tc.expected, got)
+		}
+	}
+}
+
+func TestProcessObjectStatusField(t *testing.T) {
+	matcher := &Matcher{InputField: "ip", LookupField: "network", Method: "cidr"}
+	lookuper := &tableLookuper{data: LookupData{{"network": "10.0.0.0/8", "threat": ""}}, matcher: matcher}
+	mapping := &Mapping{InputField: "ip", LookupField: "network", OutputMap: map[string]string{"threat": "threat"}}
+	processor := &recordProcessor{mapping: mapping, lookuper: lookuper, statusField: "_lookup", sourceName: "./iocs.csv"}
+
+	matched, _, _ := processor.processObject(map[string]interface{}{"ip": "10.1.2.3"})
+	unmatched, _, _ := processor.processObject(map[string]interface{}{"ip": "192.168.0.1"})
+	if status := matched["_lookup"].(*matchStatus); !status.Matched || matched["threat"] != "" {
+		t.Errorf("Expected a match with an empty threat, but got %v (%+v)", matched, status)
+	}
+	if status := unmatched["_lookup"].(*matchStatus); status.Matched {
+		t.Errorf("Expected no match, but got %+v", status)
+	}
+	if _, ok := unmatched["threat"]; ok {
+		t.Errorf("Expected no threat field for an unmatched record, but got %v", unmatched)
+	}
+}
+
+func TestStatusSourceAfterReload(t *testing.T) {
+	matcher := &Matcher{InputField: "ip", LookupField: "network", Method: "cidr"}
+	table := &tableLookuper{data: LookupData{{"network": "10.0.0.0/8"}}, matcher: matcher}
+	reloadable := &reloadableLookuper{current: table, source: "./old.csv"}
+	mapping := &Mapping{InputField: "ip", LookupField: "network"}
+	processor := &recordProcessor{mapping: mapping, lookuper: reloadable, statusField: "_lookup", sourceName: "./old.csv"}
+
+	// The source follows the configuration that was reloaded with --watch.
+	reloadable.swap(table, "https://feeds.example.com/new.csv")
+	data, _, _ := processor.processObject(map[string]interface{}{"ip": "10.1.2.3"})
+	if status := data["_lookup"].(*matchStatus); status.Source != "https://feeds.example.com/new.csv" {
+		t.Errorf("Expected the reloaded source, but got %+v", status)
+	}
+}
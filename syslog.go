@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- syslog (RFC 5424 / RFC 3164) ---
+
+// syslog ヘッダーから取り出すフィールドの名前です。値がない (NILVALUE の "-") フィールドは設定しません。
+// CEF で書き出す場合、これらは元のヘッダーとしてそのまま書き出すため、拡張には含めません。
+var syslogHeaderFields = []string{
+	"syslog_facility",
+	"syslog_severity",
+	"syslog_version",
+	"syslog_timestamp",
+	"syslog_hostname",
+	"syslog_appname",
+	"syslog_procid",
+	"syslog_msgid",
+	"syslog_structured_data",
+}
+
+// syslogMessageField はメッセージが CEF でも LEEF でもない場合に、メッセージ全体を入れるフィールドです。
+const syslogMessageField = "syslog_message"
+
+// syslogTagPattern は RFC 3164 のタグ (`sshd[1234]: `) です。
+var syslogTagPattern = regexp.MustCompile(`^([A-Za-z0-9_./-]+)(?:\[([^\]]*)\])?: ?`)
+
+// syslogRecordReader は1行1メッセージの syslog を読み込みます。
+// メッセージが CEF または LEEF の場合はその拡張や属性をフィールドに展開します。
+// syslog ヘッダーのない CEF や LEEF の行もそのまま読み込めます。値はすべて文字列になります。
+type syslogRecordReader struct {
+	scanner *lineScanner
+	line    int
+}
+
+func newSyslogRecordReader(input io.Reader) *syslogRecordReader {
+	return &syslogRecordReader{scanner: newLineScanner(input)}
+}
+
+func (r *syslogRecordReader) Read() (*inputRecord, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := strings.TrimRight(r.scanner.Text(), "\r")
+		if r.scanner.tooLong {
+			return nil, &recordError{format: "syslog", raw: line, line: r.line, err: errLineTooLong}
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rec, err := parseSyslogLine(line)
+		if err != nil {
+			return nil, &recordError{format: "syslog", raw: line, line: r.line, err: err}
+		}
+		rec.line = r.line
+		return rec, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read input: %w", err)
+	}
+	return nil, io.EOF
+}
+
+// parseSyslogLine は1行の syslog メッセージを解析します。
+func parseSyslogLine(line string) (*inputRecord, error) {
+	rec := &inputRecord{fields: make(map[string]interface{})}
+	setHeader := func(key, value string) {
+		if value != "" && value != "-" {
+			rec.set(key, value)
+		}
+	}
+
+	msg := line
+	if strings.HasPrefix(msg, "<") {
+		end := strings.IndexByte(msg, '>')
+		if end < 2 || end > 4 {
+			return nil, fmt.Errorf("invalid syslog priority")
+		}
+		pri, err := strconv.Atoi(msg[1:end])
+		if err != nil || pri > 191 {
+			return nil, fmt.Errorf("invalid syslog priority '%s'", msg[1:end])
+		}
+		setHeader("syslog_facility", strconv.Itoa(pri/8))
+		setHeader("syslog_severity", strconv.Itoa(pri%8))
+		msg = msg[end+1:]
+		if strings.HasPrefix(msg, "1 ") {
+			setHeader("syslog_version", "1")
+			if msg, err = parseRFC5424Header(msg[2:], setHeader); err != nil {
+				return nil, err
+			}
+		} else if rest, ok := parseRFC3164Header(msg, setHeader); ok {
+			msg = rest
+		}
+	} else if !isSecurityPayload(msg) {
+		rest, ok := parseRFC3164Header(msg, setHeader)
+		if !ok {
+			return nil, fmt.Errorf("not a syslog, CEF or LEEF message")
+		}
+		msg = rest
+	}
+	rec.header = line[:len(line)-len(msg)]
+
+	msg = strings.TrimPrefix(msg, "\ufeff") // RFC 5424 の BOM
+	switch {
+	case strings.HasPrefix(msg, "CEF:"):
+		return rec, parseCEF(msg, rec)
+	case strings.HasPrefix(msg, "LEEF:"):
+		return rec, parseLEEF(msg, rec)
+	default:
+		rec.set(syslogMessageField, msg)
+		return rec, nil
+	}
+}
+
+// isSecurityPayload はメッセージが CEF または LEEF かどうかを返します。
+func isSecurityPayload(msg string) bool {
+	return strings.HasPrefix(msg, "CEF:") || strings.HasPrefix(msg, "LEEF:")
+}
+
+// parseRFC5424Header は PRI とバージョンに続く RFC 5424 のヘッダーを解析し、残りのメッセージを返します。
+func parseRFC5424Header(s string, setHeader func(key, value string)) (string, error) {
+	parts := strings.SplitN(s, " ", 6)
+	if len(parts) < 6 {
+		return "", fmt.Errorf("incomplete RFC 5424 header")
+	}
+	setHeader("syslog_timestamp", parts[0])
+	setHeader("syslog_hostname", parts[1])
+	setHeader("syslog_appname", parts[2])
+	setHeader("syslog_procid", parts[3])
+	setHeader("syslog_msgid", parts[4])
+
+	rest := parts[5]
+	if strings.HasPrefix(rest, "-") {
+		return strings.TrimPrefix(rest[1:], " "), nil
+	}
+	end, err := structuredDataEnd(rest)
+	if err != nil {
+		return "", err
+	}
+	setHeader("syslog_structured_data", rest[:end])
+	return strings.TrimPrefix(rest[end:], " "), nil
+}
+
+// structuredDataEnd は s の先頭にある STRUCTURED-DATA (`[id key="value"]...`) の長さを返します。
+// 引用符の中では `\"`、`\\`、`\]` がエスケープです。
+func structuredDataEnd(s string) (int, error) {
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		inQuote := false
+		for i++; ; i++ {
+			if i >= len(s) {
+				return 0, fmt.Errorf("unterminated structured data")
+			}
+			c := s[i]
+			if inQuote && c == '\\' {
+				i++
+			} else if c == '"' {
+				inQuote = !inQuote
+			} else if c == ']' && !inQuote {
+				i++
+				break
+			}
+		}
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid structured data")
+	}
+	return i, nil
+}
+
+// parseRFC3164Header は RFC 3164 のタイムスタンプ、ホスト名、タグを解析し、残りのメッセージを返します。
+// タイムスタンプ (`Jan _2 15:04:05` または RFC 3339) で始まらない場合は ok が false になります。
+func parseRFC3164Header(s string, setHeader func(key, value string)) (rest string, ok bool) {
+	const stamp = "Jan _2 15:04:05"
+	switch {
+	case len(s) > len(stamp) && s[len(stamp)] == ' ' && isTime(stamp, s[:len(stamp)]):
+		setHeader("syslog_timestamp", s[:len(stamp)])
+		s = s[len(stamp)+1:]
+	default:
+		token, after, _ := strings.Cut(s, " ")
+		if !isTime(time.RFC3339Nano, token) {
+			return "", false
+		}
+		setHeader("syslog_timestamp", token)
+		s = after
+	}
+
+	if !isSecurityPayload(s) {
+		hostname, after, found := strings.Cut(s, " ")
+		if !found {
+			return s, true
+		}
+		setHeader("syslog_hostname", hostname)
+		s = after
+	}
+	if !isSecurityPayload(s) {
+		if m := syslogTagPattern.FindStringSubmatch(s); m != nil {
+			setHeader("syslog_appname", m[1])
+			setHeader("syslog_procid", m[2])
+			s = s[len(m[0]):]
+		}
+	}
+	return s, true
+}
+
+func isTime(layout, value string) bool {
+	_, err := time.Parse(layout, value)
+	return err == nil
+}
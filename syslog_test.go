@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSyslogLine(t *testing.T) {
+	testCases := []struct {
+		name     string
+		line     string
+		header   string
+		fields   map[string]interface{}
+		hasError bool
+	}{
+		{
+			name:   "RFC 5424 with structured data",
+			line:   `<165>1 2024-05-01T10:00:00.003Z fw01 app 1234 ID47 [ex@32473 iut="3" note="a \] b"][x@1 y="z"] hello world`,
+			header: `<165>1 2024-05-01T10:00:00.003Z fw01 app 1234 ID47 [ex@32473 iut="3" note="a \] b"][x@1 y="z"] `,
+			fields: map[string]interface{}{
+				"syslog_facility": "20", "syslog_severity": "5", "syslog_version": "1",
+				"syslog_timestamp": "2024-05-01T10:00:00.003Z", "syslog_hostname": "fw01", "syslog_appname": "app",
+				"syslog_procid": "1234", "syslog_msgid": "ID47",
+				"syslog_structured_data": `[ex@32473 iut="3" note="a \] b"][x@1 y="z"]`,
+				"syslog_message":         "hello world",
+			},
+		},
+		{
+			name:   "RFC 5424 with nil values",
+			line:   "<14>1 - - - - - - CEF:0|V|P|1|100|Name|5|src=10.0.0.1",
+			header: "<14>1 - - - - - - ",
+			fields: map[string]interface{}{
+				"syslog_facility": "1", "syslog_severity": "6", "syslog_version": "1",
+				"cef_version": "0", "cef_device_vendor": "V", "cef_device_product": "P", "cef_device_version": "1",
+				"cef_signature_id": "100", "cef_name": "Name", "cef_severity": "5", "src": "10.0.0.1",
+			},
+		},
+		{
+			name:   "RFC 3164 with tag",
+			line:   "<38>Feb  4 19:04:54 host1 sshd[812]: Accepted password for alice",
+			header: "<38>Feb  4 19:04:54 host1 sshd[812]: ",
+			fields: map[string]interface{}{
+				"syslog_facility": "4", "syslog_severity": "6", "syslog_timestamp": "Feb  4 19:04:54",
+				"syslog_hostname": "host1", "syslog_appname": "sshd", "syslog_procid": "812",
+				"syslog_message": "Accepted password for alice",
+			},
+		},
+		{
+			name:   "RFC 3164 without priority, with CEF",
+			line:   "2024-05-01T10:00:00+09:00 fw01 CEF:0|V|P|1|100|Name|5|dhost=web01",
+			header: "2024-05-01T10:00:00+09:00 fw01 ",
+			fields: map[string]interface{}{
+				"syslog_timestamp": "2024-05-01T10:00:00+09:00", "syslog_hostname": "fw01",
+				"cef_version": "0", "cef_device_vendor": "V", "cef_device_product": "P", "cef_device_version": "1",
+				"cef_signature_id": "100", "cef_name": "Name", "cef_severity": "5", "dhost": "web01",
+			},
+		},
+		{
+			name: "Bare LEEF",
+			line: "LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=10.50.1.1\tdst=2.10.20.20\tmsg=a=b",
+			fields: map[string]interface{}{
+				"leef_version": "1.0", "leef_vendor": "Microsoft", "leef_product": "MSExchange",
+				"leef_product_version": "4.0 SP1", "leef_event_id": "15345",
+				"src": "10.50.1.1", "dst": "2.10.20.20", "msg": "a=b",
+			},
+		},
+		{name: "Not syslog", line: "hello world", hasError: true},
+		{name: "Invalid priority", line: "<999>1 - - - - - - x", hasError: true},
+		{name: "Unterminated structured data", line: `<14>1 - - - - - [a b="c"`, hasError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := parseSyslogLine(tc.line)
+			if tc.hasError {
+				if err == nil {
+					t.Fatalf("Expected an error, but got %+v", rec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSyslogLine failed: %v", err)
+			}
+			if rec.header != tc.header {
+				t.Errorf("Expected header %q, but got %q", tc.header, rec.header)
+			}
+			if !reflect.DeepEqual(rec.fields, tc.fields) {
+				t.Errorf("Expected fields %v, but got %v", tc.fields, rec.fields)
+			}
+			if len(rec.keys) != len(rec.fields) {
+				t.Errorf("Expected %d keys, but got %v", len(rec.fields), rec.keys)
+			}
+		})
+	}
+}
+
+func TestProcessInputSyslogToJSON(t *testing.T) {
+	input := "<134>Feb 14 19:04:54 fw01 CEF:0|Vendor|FW|1.0|100|Login|3|suser=bob src=10.0.0.1 msg=login failed\n" +
+		"garbage\n"
+	processor := newTestProcessor(t, "suser as name OUTPUT dept")
+	var out bytes.Buffer
+	if err := processInput(strings.NewReader(input), "-", &out, ioFormats{input: "syslog", output: "json"}, processor); err != nil {
+		t.Fatalf("processInput failed: %v", err)
+	}
+	expected := `{"cef_device_product":"FW","cef_device_vendor":"Vendor","cef_device_version":"1.0","cef_name":"Login","cef_severity":"3","cef_signature_id":"100","cef_version":"0","dept":"Engineering","msg":"login failed","src":"10.0.0.1","suser":"bob","syslog_facility":"16","syslog_hostname":"fw01","syslog_severity":"6","syslog_timestamp":"Feb 14 19:04:54"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// --- テンプレートによる出力 (--template) ---
+
+// templateFuncs はテンプレートで使える補助関数です。
+var templateFuncs = template.FuncMap{
+	"default": templateDefault,
+	"join":    templateJoin,
+	"upper":   templateUpper,
+}
+
+// parseOutputTemplate は --template の値を解析します。"@" で始まる場合はファイルから読み込みます。
+func parseOutputTemplate(text string) (*template.Template, error) {
+	name := "--template"
+	if path, ok := strings.CutPrefix(text, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read template file: %w", err)
+		}
+		name, text = path, string(data)
+	}
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+// templateWriter はレコードごとにテンプレートを適用して書き出します。
+// 結果が改行で終わらない場合は改行を加え、1件のレコードを1行 (以上) として出力します。
+type templateWriter struct {
+	w    io.Writer
+	tmpl *template.Template
+	buf  bytes.Buffer
+}
+
+func (t *templateWriter) Write(rec *inputRecord) error {
+	t.buf.Reset()
+	if err := t.tmpl.Execute(&t.buf, rec.fields); err != nil {
+		return &renderError{err: err}
+	}
+	if t.buf.Len() == 0 || t.buf.Bytes()[t.buf.Len()-1] != '\n' {
+		t.buf.WriteByte('\n')
+	}
+	_, err := t.w.Write(t.buf.Bytes())
+	return err
+}
+
+func (t *templateWriter) Close() error {
+	return nil
+}
+
+// renderError はテンプレートを適用できなかったレコードのエラーです。出力には何も書き込んでいないため、
+// 呼び出し側は他の失敗したレコードと同じく --on-error に従って扱います。
+type renderError struct {
+	err error
+}
+
+func (e *renderError) Error() string {
+	return fmt.Sprintf("could not render template: %v", e.err)
+}
+
+func (e *renderError) Unwrap() error {
+	return e.err
+}
+
+// templateDefault は value が空 (フィールドがない、null、空文字列、空の配列やオブジェクト) の場合に fallback を返します。
+// `{{ .dept | default "unknown" }}` のように使います。
+func templateDefault(fallback, value interface{}) interface{} {
+	if value == nil {
+		return fallback
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			return fallback
+		}
+	}
+	return value
+}
+
+// templateJoin は配列の要素を sep で連結します。配列以外の値はそのまま文字列にします。
+// `{{ .tags | join ", " }}` のように使います。
+func templateJoin(sep string, value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(value)
+	}
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
+
+// templateUpper は値を文字列にして大文字に変換します。
+func templateUpper(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return strings.ToUpper(fmt.Sprint(value))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected string
+	}{
+		{text: `{{ .missing | default "n/a" }}`, expected: "n/a"},
+		{text: `{{ .empty | default "n/a" }}`, expected: "n/a"},
+		{text: `{{ .list0 | default "none" }}`, expected: "none"},
+		{text: `{{ .user | default "n/a" }}`, expected: "alice"},
+		{text: `{{ .count | default 0 }}`, expected: "3"},
+		{text: `{{ .tags | join ", " }}`, expected: "a, 1, true"},
+		{text: `{{ join "-" .user }}`, expected: "alice"},
+		{text: `[{{ .missing | join "," }}]`, expected: "[]"},
+		{text: `{{ upper .user }} {{ .missing | upper }}`, expected: "ALICE "},
+		{text: `{{ .nested.user.dept | upper }}`, expected: "SALES"},
+	}
+	data := map[string]interface{}{
+		"user":   "alice",
+		"empty":  "",
+		"list0":  []interface{}{},
+		"count":  3.0,
+		"tags":   []interface{}{"a", 1.0, true},
+		"nested": map[string]interface{}{"user": map[string]interface{}{"dept": "Sales"}},
+	}
+	for _, tc := range testCases {
+		tmpl, err := parseOutputTemplate(tc.text)
+		if err != nil {
+			t.Fatalf("parseOutputTemplate(%q) failed: %v", tc.text, err)
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			t.Fatalf("Execute(%q) failed: %v", tc.text, err)
+		}
+		if out.String() != tc.expected {
+			t.Errorf("%s: expected %q, but got %q", tc.text, tc.expected, out.String())
+		}
+	}
+}
+
+func TestProcessInputTemplate(t *testing.T) {
+	tmpl, err := parseOutputTemplate(`{{ .user }}: {{ .dept | default "unknown" }}{{ if .title }} ({{ .title }}){{ end }}`)
+	if err != nil {
+		t.Fatalf("parseOutputTemplate failed: %v", err)
+	}
+	expected := "alice: Sales, EMEA (Manager)\nbob: Engineering\nnobody: unknown\n"
+	for name, input := range map[string]string{
+		"JSON Lines": `{"user":"alice"}` + "\n" + `{"user":"bob"}` + "\n" + `{"user":"nobody"}` + "\n",
+		"JSON array": `[{"user":"alice"},{"user":"bob"},{"user":"nobody"}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			processor := newTestProcessor(t, "user as name OUTPUT dept, title")
+			var out bytes.Buffer
+			if err := processInput(strings.NewReader(input), "-", &out, ioFormats{input: "json", template: tmpl}, processor); err != nil {
+				t.Fatalf("processInput failed: %v", err)
+			}
+			if out.String() != expected {
+				t.Errorf("Expected:\n%s\nbut got:\n%s", expected, out.String())
+			}
+		})
+	}
+}
+
+func TestTemplateFromFileAndRenderErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alert.tmpl")
+	// The template ends with a newline, so no extra one is added; the record without a second tag fails to render.
+	if err := os.WriteFile(path, []byte("{{ .user }}:{{ index .tags 1 | upper }}\n"), 0600); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	tmpl, err := parseOutputTemplate("@" + path)
+	if err != nil {
+		t.Fatalf("parseOutputTemplate failed: %v", err)
+	}
+	var out bytes.Buffer
+	writer := &templateWriter{w: &out, tmpl: tmpl}
+	for _, fields := range []map[string]interface{}{
+		{"user": "alice", "tags": []interface{}{"a"}},
+		{"user": "bob", "tags": []interface{}{"a", "b"}},
+	} {
+		err := writer.Write(&inputRecord{fields: fields})
+		var renderErr *renderError
+		if fields["user"] == "alice" && !errors.As(err, &renderErr) {
+			t.Errorf("Expected a render error for alice, but got %v", err)
+		}
+		if fields["user"] == "bob" && err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if out.String() != "bob:B\n" {
+		t.Errorf("Expected %q, but got %q", "bob:B\n", out.String())
+	}
+	if _, err := parseOutputTemplate("@" + filepath.Join(t.TempDir(), "missing.tmpl")); err == nil {
+		t.Error("Expected an error for a missing template file")
+	}
+}
+
+func TestProcessInputTemplateOnError(t *testing.T) {
+	tmpl, err := parseOutputTemplate(`{{ .user }}:{{ index .tags 1 }}`)
+	if err != nil {
+		t.Fatalf("parseOutputTemplate failed: %v", err)
+	}
+	input := `{"user":"alice","tags":["a"]}` + "\n" + `{"user":"bob","tags":["a","b"]}` + "\n"
+	run := func(t *testing.T, mode string) (string, *errorPolicy, error) {
+		t.Helper()
+		policy, err := parseErrorPolicy(mode)
+		if err != nil {
+			t.Fatalf("parseErrorPolicy failed: %v", err)
+		}
+		t.Cleanup(func() { policy.Close() })
+		processor := newTestProcessor(t, "user as name OUTPUT dept")
+		processor.onError = policy
+		var out bytes.Buffer
+		err = processInput(strings.NewReader(input), "app.jsonl", &out, ioFormats{input: "json", template: tmpl}, processor)
+		return out.String(), policy, err
+	}
+
+	t.Run("dead-letter", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dead.jsonl")
+		out, policy, err := run(t, "dead-letter="+path)
+		if err != nil || out != "bob:b\n" {
+			t.Errorf("Expected only bob in the output, but got:\n%s (%v)", out, err)
+		}
+		if policy.droppedCount() != 1 {
+			t.Errorf("Expected 1 dropped record, but got %d", policy.droppedCount())
+		}
+		policy.Close()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read dead-letter file: %v", err)
+		}
+		var failure recordFailure
+		if err := json.Unmarshal(data, &failure); err != nil {
+			t.Fatalf("Expected one dead-letter record, but got:\n%s", data)
+		}
+		if failure.Stage != stageRender || failure.Line != 1 || failure.Record["user"] != "alice" || failure.Record["dept"] != "Sales, EMEA" || !strings.Contains(failure.Error, "could not render template") {
+			t.Errorf("Unexpected render failure: %+v", failure)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		out, _, err := run(t, "fail")
+		if err == nil || !strings.Contains(err.Error(), "line 1") || out != "" {
+			t.Errorf("Expected an error for line 1 and no output, but got %v:\n%s", err, out)
+		}
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		out, _, err := run(t, "passthrough")
+		expected := `{"dept":"Sales, EMEA","tags":["a"],"user":"alice"}` + "\n" + "bob:b\n"
+		if err != nil || out != expected {
+			t.Errorf("Expected:\n%s\nbut got:\n%s (%v)", expected, out, err)
+		}
+	})
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- validate サブコマンド ---
+
+// configProblem は validate が検出した問題です。Line が 0 の場合、行番号は不明です。
+type configProblem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p configProblem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.File, p.Message)
+}
+
+// configFileIndex は include を含む各設定ファイルの内容と、設定項目の行番号です。
+type configFileIndex struct {
+	path  string
+	doc   map[string]interface{}
+	lines map[string]int
+}
+
+// line は設定項目の行番号を返します。その項目の行番号が不明な場合は、最も近い親の行番号を返します。
+func (f *configFileIndex) line(path string) int {
+	for {
+		if line, ok := f.lines[path]; ok {
+			return line
+		}
+		if path == "" {
+			return 0
+		}
+		if i := strings.LastIndexAny(path, ".["); i >= 0 {
+			path = path[:i]
+		} else {
+			path = ""
+		}
+	}
+}
+
+// validateConfig は設定ファイルと include されたファイルを検証し、見つかったすべての問題を返します。
+// スキーマ (未知のフィールド、型、列挙値) と環境変数の参照を検証した後、
+// データソースを読み込み、lookup_field の存在と regex / cidr / wildcard の各行のパターンを検証します。
+func validateConfig(configPath string) []configProblem {
+	schema, err := loadConfigSchema()
+	if err != nil {
+		return []configProblem{{File: configPath, Message: err.Error()}}
+	}
+
+	var problems []configProblem
+	var files []*configFileIndex
+	for _, path := range configFiles(configPath) {
+		file, fileProblems := indexConfigFile(path, schema)
+		problems = append(problems, fileProblems...)
+		if file != nil {
+			files = append(files, file)
+		}
+	}
+
+	doc, err := loadConfigDocument(configPath, nil)
+	if err != nil {
+		// スキーマの検証で原因を報告済みでない場合のみ追加します。
+		if len(problems) == 0 {
+			problems = append(problems, configProblem{File: configPath, Message: err.Error()})
+		}
+		return problems
+	}
+	// 型の誤りはスキーマの検証で報告済みのため、json.Unmarshal が読み飛ばした項目以外で検証を続けます。
+	var config Config
+	if data, err := json.Marshal(doc); err == nil {
+		json.Unmarshal(data, &config)
+	}
+	setConfigDefaults(&config)
+	return append(problems, validateDataSource(configPath, &config, files)...)
+}
+
+// indexConfigFile は1つの設定ファイルを読み込み、スキーマと環境変数の参照を検証します。
+func indexConfigFile(path string, schema *jsonSchema) (*configFileIndex, []configProblem) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, []configProblem{{File: path, Message: fmt.Sprintf("could not read config file: %v", err)}}
+	}
+	format := configFormatFromPath(path)
+	doc, err := parseConfigDocument(data, format)
+	if err != nil {
+		return nil, []configProblem{{File: path, Message: err.Error()}}
+	}
+	file := &configFileIndex{path: path, doc: doc, lines: configLines(data, format)}
+
+	var problems []configProblem
+	for _, v := range schema.validate(doc, "") {
+		message := v.Message
+		if v.Path != "" {
+			message = v.Path + ": " + message
+		}
+		problems = append(problems, configProblem{File: path, Line: file.line(v.Path), Message: message})
+	}
+	walkConfigStrings(doc, "", func(location, s string) {
+		if _, err := expandEnvReferences(s); err != nil {
+			problems = append(problems, configProblem{File: path, Line: file.line(location), Message: fmt.Sprintf("%s: %v", location, err)})
+		}
+	})
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return file, problems
+}
+
+// walkConfigStrings は値に含まれるすべての文字列を、その位置とともに fn に渡します。
+func walkConfigStrings(value interface{}, location string, fn func(location, s string)) {
+	switch v := value.(type) {
+	case string:
+		fn(location, v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			walkConfigStrings(v[key], joinConfigPath(location, key), fn)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			walkConfigStrings(elem, fmt.Sprintf("%s[%d]", location, i), fn)
+		}
+	}
+}
+
+// matcherLocation は、結合後の設定の matcher がどのファイルのどの行で定義されたかを表します。
+type matcherLocation struct {
+	file *configFileIndex
+	path string
+}
+
+func (l matcherLocation) problem(format string, args ...interface{}) configProblem {
+	return configProblem{File: l.file.path, Line: l.file.line(l.path), Message: l.path + ": " + fmt.Sprintf(format, args...)}
+}
+
+// locateMatchers は結合後の各 matcher が定義されたファイルと位置を探します。
+// include による結合で順序が変わるため、内容が一致する matcher を対応付けます。
+func locateMatchers(configPath string, matchers []Matcher, files []*configFileIndex) []matcherLocation {
+	type candidate struct {
+		location matcherLocation
+		matcher  Matcher
+		used     bool
+	}
+	var candidates []*candidate
+	for _, file := range files {
+		list, _ := file.doc["matchers"].([]interface{})
+		for i, raw := range list {
+			obj, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var m Matcher
+			if expanded, err := expandConfigValue(copyConfigValue(obj), ""); err == nil {
+				if data, err := json.Marshal(expanded); err == nil {
+					json.Unmarshal(data, &m)
+				}
+			}
+			if m.Method == "" {
+				m.Method = "exact"
+			}
+			candidates = append(candidates, &candidate{location: matcherLocation{file: file, path: fmt.Sprintf("matchers[%d]", i)}, matcher: m})
+		}
+	}
+
+	fallback := &configFileIndex{path: configPath}
+	if len(files) > 0 {
+		fallback = files[0]
+	}
+	locations := make([]matcherLocation, len(matchers))
+	for i, m := range matchers {
+		locations[i] = matcherLocation{file: fallback, path: fmt.Sprintf("matchers[%d]", i)}
+		for _, c := range candidates {
+			if !c.used && c.matcher == m {
+				c.used = true
+				locations[i] = c.location
+				break
+			}
+		}
+	}
+	return locations
+}
+
+// copyConfigValue は汎用的な設定値を複製します。
+func copyConfigValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			result[key] = copyConfigValue(elem)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = copyConfigValue(elem)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// validateDataSource はデータソースを開き、matcher がデータソースに対して有効かを検証します。
+func validateDataSource(configPath string, config *Config, files []*configFileIndex) []configProblem {
+	var problems []configProblem
+	root := matcherLocation{file: &configFileIndex{path: configPath}}
+	if len(files) > 0 {
+		root.file = files[0]
+	}
+	rootProblem := func(path, format string, args ...interface{}) {
+		problems = append(problems, matcherLocation{file: root.file, path: path}.problem(format, args...))
+	}
+	locations := locateMatchers(configPath, config.Matchers, files)
+
+	switch config.Type {
+	case "", "file":
+		if config.DataSource == "" {
+			rootProblem("data_source", "is required")
+			return problems
+		}
+		sourcePath, err := resolveConfiguredDataSource(configPath, config)
+		if err != nil {
+			rootProblem("data_source", "%v", err)
+			return problems
+		}
+		paths := []string{sourcePath}
+		if isMultiFileSource(sourcePath) {
+			if paths, err = expandDataSource(sourcePath, config.Merge); err != nil {
+				rootProblem("data_source", "%v", err)
+				return problems
+			}
+		}
+		for _, path := range paths {
+			problems = append(problems, validateDataFile(path, config.Matchers, locations)...)
+		}
+	case "kv":
+		if config.DataSource == "" {
+			rootProblem("data_source", "is required")
+			return problems
+		}
+		sourcePath, err := resolveConfiguredDataSource(configPath, config)
+		if err != nil {
+			rootProblem("data_source", "%v", err)
+			return problems
+		}
+		for i := range config.Matchers {
+			lookuper, err := newKVLookuper(sourcePath, &config.Matchers[i])
+			if err != nil {
+				problems = append(problems, locations[i].problem("%v", err))
+				continue
+			}
+			lookuper.Close()
+		}
+	case "mmdb":
+		if config.DataSource == "" {
+			rootProblem("data_source", "is required")
+			return problems
+		}
+		sourcePath, err := resolveConfiguredDataSource(configPath, config)
+		if err == nil {
+			_, err = openMMDB(sourcePath)
+		}
+		if err != nil {
+			rootProblem("data_source", "%v", err)
+		}
+	case "http":
+		if config.HTTP == nil {
+			rootProblem("http", "is required when type is 'http'")
+		} else if _, err := newHTTPLookuper(config.HTTP); err != nil {
+			rootProblem("http", "%v", err)
+		}
+	}
+	return problems
+}
+
+// validateDataFile は1つのデータファイルについて、各 matcher の lookup_field が存在するか、
+// また regex / cidr / wildcard の各行のパターンが有効かを検証します。
+func validateDataFile(path string, matchers []Matcher, locations []matcherLocation) []configProblem {
+	var problems []configProblem
+	name := filepath.Base(path)
+	fields := make(map[string]struct{})
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		header, err := extractHeadersFromCSV(path)
+		if err != nil {
+			return []configProblem{{File: path, Message: err.Error()}}
+		}
+		for _, field := range header {
+			fields[field] = struct{}{}
+		}
+	}
+
+	// 同じパターンのエラーを繰り返し検証しないよう、結果を記録します。
+	type patternKey struct{ method, pattern string }
+	checked := make(map[patternKey]error)
+	err := scanLookupDataLines(path, func(row map[string]string, line int) error {
+		for field := range row {
+			fields[field] = struct{}{}
+		}
+		for i := range matchers {
+			m := &matchers[i]
+			if m.Method == "exact" {
+				continue
+			}
+			value, ok := row[m.LookupField]
+			if !ok || value == "" {
+				continue
+			}
+			pattern := normalizeLookupValue(value, m)
+			key := patternKey{m.Method, pattern}
+			err, seen := checked[key]
+			if !seen {
+				err = compileLookupPattern(m.Method, pattern)
+				checked[key] = err
+			}
+			if err != nil {
+				problems = append(problems, configProblem{
+					File:    path,
+					Line:    line,
+					Message: fmt.Sprintf("invalid %s pattern %q in column '%s' (matchers[%d]): %v", m.Method, value, m.LookupField, i, err),
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return append(problems, configProblem{File: path, Message: err.Error()})
+	}
+
+	available := make([]string, 0, len(fields))
+	for field := range fields {
+		available = append(available, field)
+	}
+	sort.Strings(available)
+	var missing []configProblem
+	for i, m := range matchers {
+		if _, ok := fields[m.LookupField]; !ok {
+			missing = append(missing, locations[i].problem("lookup_field '%s' not found in data source %s (available: %s)", m.LookupField, name, strings.Join(available, ", ")))
+		}
+	}
+	return append(missing, problems...)
+}
+
+// compileLookupPattern は findMatch と同じ方法でパターンを解釈し、無効な場合はエラーを返します。
+func compileLookupPattern(method, pattern string) error {
+	switch method {
+	case "regex":
+		_, err := regexp.Compile(pattern)
+		return err
+	case "wildcard":
+		_, err := filepath.Match(pattern, "")
+		return err
+	case "cidr":
+		_, _, err := net.ParseCIDR(pattern)
+		return err
+	default:
+		return nil
+	}
+}
+
+// --- 設定項目の行番号 ---
+
+// configLines は設定ファイルの各項目 (例: "matchers[0].method") の行番号を返します。
+// 解析できない場合は、分かった範囲の行番号を返します。
+func configLines(data []byte, format string) map[string]int {
+	lines := make(map[string]int)
+	switch format {
+	case "json":
+		jsonConfigLines(data, lines)
+	case "yaml":
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err == nil && len(node.Content) > 0 {
+			yamlConfigLines(node.Content[0], "", lines)
+		}
+	case "toml":
+		tomlConfigLines(data, lines)
+	}
+	return lines
+}
+
+func jsonConfigLines(data []byte, lines map[string]int) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	lineAt := func(offset int64) int {
+		return bytes.Count(data[:offset], []byte{'\n'}) + 1
+	}
+	var walk func(path string) error
+	walk = func(path string) error {
+		tok, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := lines[path]; !ok {
+			lines[path] = lineAt(decoder.InputOffset() - 1)
+		}
+		switch tok {
+		case json.Delim('{'):
+			for decoder.More() {
+				keyTok, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				key, _ := keyTok.(string)
+				child := joinConfigPath(path, key)
+				lines[child] = lineAt(decoder.InputOffset() - 1)
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+			_, err = decoder.Token()
+		case json.Delim('['):
+			for i := 0; decoder.More(); i++ {
+				if err := walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			_, err = decoder.Token()
+		}
+		return err
+	}
+	walk("")
+}
+
+func yamlConfigLines(node *yaml.Node, path string, lines map[string]int) {
+	if _, ok := lines[path]; !ok {
+		lines[path] = node.Line
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			child := joinConfigPath(path, node.Content[i].Value)
+			lines[child] = node.Content[i].Line
+			yamlConfigLines(node.Content[i+1], child, lines)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			yamlConfigLines(item, fmt.Sprintf("%s[%d]", path, i), lines)
+		}
+	}
+}
+
+var (
+	tomlTablePattern = regexp.MustCompile(`^\s*(\[\[?)\s*([^\]]+?)\s*\]\]?`)
+	tomlKeyPattern   = regexp.MustCompile(`^\s*("[^"]*"|'[^']*'|[A-Za-z0-9_\-.$]+)\s*=`)
+)
+
+// tomlConfigLines はテーブルの見出しとキーの行から、各項目の行番号を求めます。
+// 複数行文字列の中の行は無視します。インラインテーブルの中の項目は、親の項目の行番号になります。
+func tomlConfigLines(data []byte, lines map[string]int) {
+	lines[""] = 1
+	prefix := ""
+	arrayCounts := make(map[string]int)
+	inMultiline := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		text := scanner.Text()
+		if inMultiline != "" {
+			if strings.Count(text, inMultiline)%2 == 1 {
+				inMultiline = ""
+			}
+			continue
+		}
+		if m := tomlTablePattern.FindStringSubmatch(text); m != nil {
+			name := unquoteTOMLKey(m[2])
+			if m[1] == "[[" {
+				index := arrayCounts[name]
+				arrayCounts[name] = index + 1
+				prefix = fmt.Sprintf("%s[%d]", name, index)
+				if index == 0 {
+					lines[name] = lineNo
+				}
+			} else {
+				prefix = name
+			}
+			lines[prefix] = lineNo
+			continue
+		}
+		if m := tomlKeyPattern.FindStringSubmatch(text); m != nil {
+			lines[joinConfigPath(prefix, unquoteTOMLKey(m[1]))] = lineNo
+			for _, delim := range []string{`"""`, `'''`} {
+				if strings.Count(text, delim)%2 == 1 {
+					inMultiline = delim
+				}
+			}
+		}
+	}
+}
+
+// unquoteTOMLKey は TOML のキーの引用符を取り除きます。
+func unquoteTOMLKey(key string) string {
+	key = strings.TrimSpace(key)
+	if s, err := strconv.Unquote(key); err == nil && strings.HasPrefix(key, `"`) {
+		return s
+	}
+	return strings.Trim(key, "'")
+}
+
+// handleValidate は validate サブコマンドの引数を処理し、実行します。
+func handleValidate() {
+	cmd := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := cmd.String("c", "", "Path to the lookup configuration file to validate.")
+	printSchema := cmd.Bool("schema", false, "Print the JSON Schema of the configuration file and exit.")
+	cmd.Parse(os.Args[2:])
+
+	if *printSchema {
+		os.Stdout.Write(configSchemaJSON)
+		return
+	}
+	if *configPath == "" {
+		log.Fatal("Error: -c flag is required for validate command.")
+	}
+
+	problems := validateConfig(*configPath)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		log.Fatalf("Error: %d problem(s) found in %s", len(problems), *configPath)
+	}
+	log.Printf("%s is valid", *configPath)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeValidateFixture writes a data source with one invalid regex row and
+// the given config, and returns the config path.
+func writeValidateFixture(t *testing.T, configName, config string) string {
+	t.Helper()
+	dir := t.TempDir()
+	data := "pattern,name\nok.*,first\n[bad,second\n"
+	if err := os.WriteFile(filepath.Join(dir, "patterns.csv"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write data source: %v", err)
+	}
+	configPath := filepath.Join(dir, configName)
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return configPath
+}
+
+// problemSummaries returns the problems as "file:line: message" with the
+// directory removed from file names.
+func problemSummaries(problems []configProblem) []string {
+	var out []string
+	for _, p := range problems {
+		p.File = filepath.Base(p.File)
+		out = append(out, p.String())
+	}
+	return out
+}
+
+func TestValidateConfig(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     string
+		config   string
+		expected []string
+	}{
+		{
+			name: "JSON",
+			file: "config.json",
+			config: `{
+  "data_source": "./patterns.csv",
+  "matchers": [
+    {"input_field": "a", "lookup_field": "pattern", "methd": "regex"},
+    {"input_field": "b", "lookup_field": "pattern", "method": "regex"},
+    {"input_field": "c", "lookup_field": "patern"}
+  ]
+}`,
+			expected: []string{
+				`config.json:4: matchers[0].methd: unknown field "methd" (did you mean "method"?)`,
+				`config.json:6: matchers[2]: lookup_field 'patern' not found in data source patterns.csv (available: name, pattern)`,
+				`patterns.csv:3: invalid regex pattern "[bad" in column 'pattern' (matchers[1]): error parsing regexp: missing closing ]: ` + "`[bad`",
+			},
+		},
+		{
+			name: "YAML",
+			file: "config.yaml",
+			config: `data_source: ./patterns.csv
+matchers:
+  - input_field: a
+    lookup_field: pattern
+    method: regx
+    case_sensitive: "yes"
+`,
+			expected: []string{
+				`config.yaml:5: matchers[0].method: "regx" is not one of exact, wildcard, regex, cidr`,
+				`config.yaml:6: matchers[0].case_sensitive: expected boolean, got string`,
+			},
+		},
+		{
+			name: "TOML",
+			file: "config.toml",
+			config: `data_source = "${LOOKUP_TEST_UNSET_DIR}/patterns.csv"
+[remote]
+timeout = 30
+
+[[matchers]]
+input_field = "a"
+lookup_field = "pattern"
+`,
+			expected: []string{
+				`config.toml:1: data_source: environment variable LOOKUP_TEST_UNSET_DIR is not set`,
+				`config.toml:3: remote.timeout: expected string, got integer`,
+			},
+		},
+		{
+			name: "Valid",
+			file: "config.json",
+			config: `{
+  "$schema": "./schema/config.schema.json",
+  "data_source": "./patterns.csv",
+  "matchers": [{"input_field": "name", "lookup_field": "name", "case_sensitive": true}]
+}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := writeValidateFixture(t, tc.file, tc.config)
+			got := problemSummaries(validateConfig(configPath))
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected problems:\n%s\nbut got:\n%s", strings.Join(tc.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestValidateConfigInclude(t *testing.T) {
+	configPath := writeValidateFixture(t, "team.yaml", `include: common.json
+data_source: ./patterns.csv
+matchers:
+  - input_field: a
+    lookup_field: pattern
+`)
+	common := `{
+  "matchers": [
+    {"input_field": "b", "lookup_field": "missing"}
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(filepath.Dir(configPath), "common.json"), []byte(common), 0600); err != nil {
+		t.Fatalf("Failed to write included config: %v", err)
+	}
+
+	got := problemSummaries(validateConfig(configPath))
+	expected := []string{
+		`common.json:3: matchers[0]: lookup_field 'missing' not found in data source patterns.csv (available: name, pattern)`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected problems %v, but got %v", expected, got)
+	}
+}
+
+func TestConfigLines(t *testing.T) {
+	testCases := []struct {
+		format   string
+		data     string
+		expected map[string]int
+	}{
+		{
+			format: "json",
+			data:   "{\n  \"a\": 1,\n  \"list\": [\n    {\"b\": 2},\n    {\n      \"c\": 3\n    }\n  ]\n}",
+			expected: map[string]int{
+				"": 1, "a": 2, "list": 3, "list[0]": 4, "list[0].b": 4, "list[1]": 5, "list[1].c": 6,
+			},
+		},
+		{
+			format: "toml",
+			data:   "a = 1\n\n[table]\nb = \"\"\"\nc = not a key\n\"\"\"\n\n[[list]]\nc = 3\n[[list]]\nc = 4\n",
+			expected: map[string]int{
+				"": 1, "a": 1, "table": 3, "table.b": 4, "list": 8, "list[0]": 8, "list[0].c": 9, "list[1]": 10, "list[1].c": 11,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			got := configLines([]byte(tc.data), tc.format)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %v, but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestScanLookupDataLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rows.json")
+	data := "[\n  {\"id\": \"a\"},\n\n  {\n    \"id\": \"b\"\n  }, {\"id\": \"c\"}\n]\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	lines := map[string]int{}
+	err := scanLookupDataLines(path, func(row map[string]string, line int) error {
+		lines[row["id"]] = line
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scanLookupDataLines failed: %v", err)
+	}
+	expected := map[string]int{"a": 2, "b": 4, "c": 6}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %v, but got %v", expected, lines)
+	}
+}